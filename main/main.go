@@ -4,17 +4,24 @@ import (
 	"context"
 	"flag"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
-	"github.com/vitrevance/api-exporter/pkg/fread"
+	"github.com/vitrevance/api-exporter/pkg/metrics"
 	"github.com/vitrevance/api-exporter/pkg/runner"
-	"github.com/vitrevance/api-exporter/pkg/transformer"
+	"github.com/vitrevance/api-exporter/pkg/secret"
+	httpt "github.com/vitrevance/api-exporter/pkg/transformer/http"
 	"gopkg.in/yaml.v3"
 
 	_ "github.com/vitrevance/api-exporter/pkg/transformer/array"
 	_ "github.com/vitrevance/api-exporter/pkg/transformer/field"
-	_ "github.com/vitrevance/api-exporter/pkg/transformer/http"
 	_ "github.com/vitrevance/api-exporter/pkg/transformer/js"
+	_ "github.com/vitrevance/api-exporter/pkg/transformer/metric"
 	_ "github.com/vitrevance/api-exporter/pkg/transformer/parser"
 	_ "github.com/vitrevance/api-exporter/pkg/transformer/print"
 	_ "github.com/vitrevance/api-exporter/pkg/transformer/regex"
@@ -23,8 +30,23 @@ import (
 )
 
 func main() {
-	configPath := flag.String("config", "config.yaml", "path to a config file")
+	log.SetOutput(secret.Writer(os.Stderr))
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "validate":
+			os.Exit(validate(os.Args[2:]))
+		case "run":
+			os.Exit(run(os.Args[2:]))
+		}
+	}
+
+	configPath := flag.String("config", "config.yaml", "path to a config file or directory")
 	reloadIntervalStr := flag.String("reloadInterval", "0s", "config reload interval")
+	cassetteDir := flag.String("http-cassette", "", "directory to record http interactions to or replay them from")
+	cassetteMode := flag.String("http-cassette-mode", httpt.CassetteReplay, "http cassette mode: record, replay or passthrough")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "how long running jobs may take to finish on SIGTERM or SIGINT before they are cancelled")
+	drainTimeout := flag.Duration("drain-timeout", 30*time.Second, "how long runs of jobs removed or changed by a reload may take to finish before they are cancelled")
+	listenAddr := flag.String("listen", "", "address to serve /metrics, /probe and /status on, e.g. :9090; disabled if empty")
 	flag.Parse()
 
 	var reloadInterval time.Duration
@@ -33,60 +55,60 @@ func main() {
 		log.Fatalf("invalid reloadInterval format: %v", err)
 	}
 
-	cfgUpdates := reloadConfig(*configPath, reloadInterval)
+	if *cassetteDir != "" {
+		err = httpt.SetCassette(*cassetteDir, *cassetteMode)
+		if err != nil {
+			log.Fatalf("invalid http cassette: %v", err)
+		}
+	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	for cfg := range cfgUpdates {
-		cancel()
-		ctx, cancel = context.WithCancel(context.Background())
-		cfg.RunJobs(ctx)
+	var current atomic.Pointer[runner.Config]
+	reloader := runner.NewReloader(*configPath, reloadInterval)
+	if *listenAddr != "" {
+		go serve(*listenAddr, current.Load, reloader.Status)
 	}
-	cancel()
-}
 
-func reloadConfig(path string, reloadInterval time.Duration) <-chan *runner.Config {
-	ch := make(chan *runner.Config)
-	var lastConfig string
-	var cfg *runner.Config
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
 	go func() {
-		defer close(ch)
-		for {
-			func() {
-				bytes, err := fread.ReadFileOrHTTP(path)
-				if err != nil {
-					log.Printf("[ERROR] failed to reload config file: %v", err)
-					time.Sleep(time.Second * 5)
-					return
-				}
+		for range hup {
+			reloader.Reload("SIGHUP")
+		}
+	}()
+	cfgUpdates := reloader.Start(context.Background())
 
-				if lastConfig == string(bytes) {
-					log.Println("[INFO] reloaded config with no changes")
-					time.Sleep(reloadInterval)
-					return
-				}
-				lastConfig = string(bytes)
+	shutdown, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	// runs are not derived from shutdown, they are given shutdownTimeout to finish
+	scheduler := runner.NewScheduler(context.Background(), *drainTimeout)
+	for running := true; running; {
+		select {
+		case cfg := <-cfgUpdates:
+			secret.SetRules(cfg.Redact, cfg.Secrets)
+			current.Store(cfg)
+			scheduler.Apply(cfg)
+		case <-shutdown.Done():
+			running = false
+		}
+	}
+	// a second signal kills the process right away
+	stop()
 
-				if cfg != nil {
-					for k, _ := range cfg.Transformers {
-						transformer.UnregisterTransformerFactory(k)
-					}
-				}
+	log.Printf("[INFO] shutting down, waiting up to %s for running jobs", *shutdownTimeout)
+	interrupted := scheduler.Shutdown(*shutdownTimeout)
+	if len(interrupted) > 0 {
+		log.Printf("[ERROR] shutdown timed out, interrupted jobs: %s", strings.Join(interrupted, ", "))
+		os.Exit(1)
+	}
+	log.Println("[INFO] shutdown complete")
+}
 
-				cfg = &runner.Config{}
-				err = yaml.Unmarshal(bytes, cfg)
-				if err != nil {
-					log.Printf("[ERROR] failed to read config: %v", err)
-					time.Sleep(time.Second * 5)
-					return
-				}
-				log.Println("[INFO] reloaded config")
-				ch <- cfg
-			}()
-			if reloadInterval == 0 {
-				return
-			}
-			time.Sleep(reloadInterval)
-		}
-	}()
-	return ch
+func serve(addr string, config func() *runner.Config, status http.Handler) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/probe", runner.ProbeHandler(config))
+	mux.Handle("/status", status)
+	log.Printf("[INFO] listening on %s", addr)
+	err := http.ListenAndServe(addr, mux)
+	log.Fatalf("http server failed: %v", err)
 }
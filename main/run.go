@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/vitrevance/api-exporter/pkg/runner"
+	"github.com/vitrevance/api-exporter/pkg/secret"
+	"github.com/vitrevance/api-exporter/pkg/transformer"
+	httpt "github.com/vitrevance/api-exporter/pkg/transformer/http"
+)
+
+// stringsFlag collects values of a repeated flag
+type stringsFlag []string
+
+func (this *stringsFlag) String() string {
+	return strings.Join(*this, ",")
+}
+
+func (this *stringsFlag) Set(value string) error {
+	*this = append(*this, value)
+	return nil
+}
+
+// run implements `api-exporter run -job name [-job name...] -once` and returns the exit code
+func run(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	configPath := flags.String("config", "config.yaml", "path to a config file or directory")
+	var jobNames stringsFlag
+	flags.Var(&jobNames, "job", "name of a job to run, may be repeated")
+	once := flags.Bool("once", false, "run every job exactly once and exit instead of following their schedules")
+	inputPath := flags.String("input", "", "JSON file with the object passed to the first step")
+	trace := flags.Bool("trace", false, "print the object and result before and after every step")
+	cassetteDir := flags.String("http-cassette", "", "directory to record http interactions to or replay them from")
+	cassetteMode := flags.String("http-cassette-mode", httpt.CassetteReplay, "http cassette mode: record, replay or passthrough")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: api-exporter run -job name [-job name...] [-once] [-input file.json] [-trace] [-http-cassette dir [-http-cassette-mode mode]]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if len(jobNames) == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	if *cassetteDir != "" {
+		if err := httpt.SetCassette(*cassetteDir, *cassetteMode); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid http cassette: %v\n", err)
+			return 2
+		}
+	}
+
+	cfg, err := runner.LoadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, secret.Redact(fmt.Sprintf("failed to read config: %v", err)))
+		return 2
+	}
+	secret.SetRules(cfg.Redact, cfg.Secrets)
+
+	var input any
+	if *inputPath != "" {
+		data, err := os.ReadFile(*inputPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, secret.Redact(err.Error()))
+			return 2
+		}
+		if err := json.Unmarshal(data, &input); err != nil {
+			fmt.Fprintln(os.Stderr, secret.Redact(fmt.Sprintf("invalid input %q: %v", *inputPath, err)))
+			return 2
+		}
+	}
+
+	jobs := make([]runner.JobConfig, 0, len(jobNames))
+	for _, name := range jobNames {
+		job, ok := cfg.Job(name)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown job %q\n", name)
+			return 2
+		}
+		jobs = append(jobs, job)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx = runner.WithObserver(ctx, &printObserver{out: secret.Writer(os.Stdout), trace: *trace})
+
+	if !*once {
+		cfg.Jobs = jobs
+		cfg.RunJobs(ctx)
+		<-ctx.Done()
+		return 0
+	}
+
+	code := 0
+	for _, job := range jobs {
+		var object any = make(map[string]any)
+		if input != nil {
+			object = input
+		}
+		if err := cfg.RunJob(ctx, job, object); err != nil {
+			fmt.Println(secret.Redact(fmt.Sprintf("job %s failed: %v", job.JobName, err)))
+			code = 1
+		}
+	}
+	return code
+}
+
+// printObserver prints results of steps and, when tracing, their contexts
+type printObserver struct {
+	out   io.Writer
+	trace bool
+}
+
+func (this *printObserver) BeforeStep(job string, index int, step transformer.TransformerConfig, ctx *transformer.TransformationContext) {
+	if this.trace {
+		fmt.Fprintf(this.out, "--- %s step [%d] %s: before\nobject: %s\nresult: %s\n", job, index, step.Type, formatValue(ctx.Object), formatValue(ctx.Result))
+	}
+}
+
+func (this *printObserver) AfterStep(job string, index int, step transformer.TransformerConfig, ctx *transformer.TransformationContext, err error) {
+	if err != nil {
+		fmt.Fprintf(this.out, "--- %s step [%d] %s: failed: %v\n", job, index, step.Type, err)
+		return
+	}
+	if this.trace {
+		fmt.Fprintf(this.out, "--- %s step [%d] %s: after\nobject: %s\nresult: %s\n", job, index, step.Type, formatValue(ctx.Object), formatValue(ctx.Result))
+		return
+	}
+	fmt.Fprintf(this.out, "--- %s step [%d] %s\n%s\n", job, index, step.Type, formatValue(ctx.Result))
+}
+
+// formatValue renders v as indented JSON with bytes shown as text
+func formatValue(v any) string {
+	data, err := json.MarshalIndent(printable(v), "", "  ")
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
+
+func printable(v any) any {
+	switch t := v.(type) {
+	case []byte:
+		if utf8.Valid(t) {
+			return string(t)
+		}
+		return t
+	case map[string]any:
+		m := make(map[string]any, len(t))
+		for k, v := range t {
+			m[k] = printable(v)
+		}
+		return m
+	case []any:
+		arr := make([]any, len(t))
+		for i, v := range t {
+			arr[i] = printable(v)
+		}
+		return arr
+	case transformer.Stream:
+		return "<stream>"
+	default:
+		return v
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/vitrevance/api-exporter/pkg/runner"
+	"github.com/vitrevance/api-exporter/pkg/secret"
+)
+
+// validate implements `api-exporter validate [-config path]` and returns the exit code
+func validate(args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	configPath := flags.String("config", "config.yaml", "path to a config file or directory")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: api-exporter validate [-config path]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		*configPath = flags.Arg(0)
+	}
+
+	files, err := runner.ReadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, secret.Redact(err.Error()))
+		return 2
+	}
+	errs := runner.ValidateFiles(files)
+	for _, err := range errs {
+		fmt.Println(secret.Redact(err.Error()))
+	}
+	if len(errs) > 0 {
+		fmt.Printf("%s: %d error(s)\n", *configPath, len(errs))
+		return 1
+	}
+	fmt.Printf("%s: ok\n", *configPath)
+	return 0
+}
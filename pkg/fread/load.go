@@ -6,18 +6,50 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"sync"
+)
+
+// cached is the last response for an url along with its validators
+type cached struct {
+	etag         string
+	lastModified string
+	data         []byte
+}
+
+var (
+	cacheMu sync.Mutex
+	cache   = make(map[string]cached)
 )
 
 // ReadFileOrHTTP reads path either from local filesystem or from http if path starts with http or https.
+// Http reads are conditional on the ETag and Last-Modified of the previous response, which is reused on 304.
 func ReadFileOrHTTP(path string) ([]byte, error) {
-	if isHTTPURL(path) {
+	if IsHTTPURL(path) {
 		// reads remote file via http or https, if url is given
-		resp, err := http.Get(path)
+		req, err := http.NewRequest(http.MethodGet, path, nil)
+		if err != nil {
+			return nil, fmt.Errorf("cannot fetch %q: %w", path, err)
+		}
+		cacheMu.Lock()
+		prev, ok := cache[path]
+		cacheMu.Unlock()
+		if ok {
+			if prev.etag != "" {
+				req.Header.Set("If-None-Match", prev.etag)
+			}
+			if prev.lastModified != "" {
+				req.Header.Set("If-Modified-Since", prev.lastModified)
+			}
+		}
+		resp, err := http.DefaultClient.Do(req)
 		if err != nil {
 			return nil, fmt.Errorf("cannot fetch %q: %w", path, err)
 		}
 		data, err := io.ReadAll(resp.Body)
 		_ = resp.Body.Close()
+		if resp.StatusCode == http.StatusNotModified && ok {
+			return prev.data, nil
+		}
 		if resp.StatusCode != http.StatusOK {
 			if len(data) > 4*1024 {
 				data = data[:4*1024]
@@ -27,6 +59,12 @@ func ReadFileOrHTTP(path string) ([]byte, error) {
 		if err != nil {
 			return nil, fmt.Errorf("cannot read %q: %w", path, err)
 		}
+		etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+		if etag != "" || lastModified != "" {
+			cacheMu.Lock()
+			cache[path] = cached{etag: etag, lastModified: lastModified, data: data}
+			cacheMu.Unlock()
+		}
 		return data, nil
 	}
 	data, err := os.ReadFile(path)
@@ -36,8 +74,8 @@ func ReadFileOrHTTP(path string) ([]byte, error) {
 	return data, nil
 }
 
-// isHTTPURL checks if a given targetURL is valid and contains a valid http scheme
-func isHTTPURL(targetURL string) bool {
+// IsHTTPURL checks if a given targetURL is valid and contains a valid http scheme
+func IsHTTPURL(targetURL string) bool {
 	parsed, err := url.Parse(targetURL)
 	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
 
@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "api_exporter"
+
+// Registry holds every metric served on /metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	JobRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "job_runs_total",
+		Help:      "Number of job runs by outcome.",
+	}, []string{"job_name", "status"})
+
+	JobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_duration_seconds",
+		Help:      "Duration of job runs.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 4, 10),
+	}, []string{"job_name"})
+
+	JobLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "job_last_success_timestamp_seconds",
+		Help:      "Unix time of the last successful job run.",
+	}, []string{"job_name"})
+
+	StepDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "step_duration_seconds",
+		Help:      "Duration of job steps.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10),
+	}, []string{"job_name", "step", "type"})
+
+	StepFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "step_failures_total",
+		Help:      "Number of failed job steps.",
+	}, []string{"job_name", "step", "type"})
+
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of requests made by the http transformer by status code, \"error\" if no response was received.",
+	}, []string{"method", "host", "status_code"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of requests made by the http transformer.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "host"})
+
+	ConfigInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "config_info",
+		Help:      "Always 1, labeled with the hash of the running config.",
+	}, []string{"hash"})
+
+	ConfigLastReload = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "config_last_reload_timestamp_seconds",
+		Help:      "Unix time the running config was loaded.",
+	})
+
+	ConfigReloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "config_reloads_total",
+		Help:      "Number of config reloads by outcome, a failed reload keeps the previous config running.",
+	}, []string{"status"})
+
+	ConfigLastReloadSuccessful = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "config_last_reload_successful",
+		Help:      "Whether the last config reload succeeded, 1 or 0.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		JobRuns,
+		JobDuration,
+		JobLastSuccess,
+		StepDuration,
+		StepFailures,
+		HTTPRequests,
+		HTTPRequestDuration,
+		ConfigInfo,
+		ConfigLastReload,
+		ConfigReloads,
+		ConfigLastReloadSuccessful,
+	)
+}
+
+// ForgetJob drops every series of job, e.g. once it is removed from the config
+func ForgetJob(job string) {
+	DefaultStore.Forget(job)
+	labels := prometheus.Labels{"job_name": job}
+	JobRuns.DeletePartialMatch(labels)
+	JobDuration.DeletePartialMatch(labels)
+	JobLastSuccess.DeletePartialMatch(labels)
+	StepDuration.DeletePartialMatch(labels)
+	StepFailures.DeletePartialMatch(labels)
+}
+
+// Handler serves Registry in the exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
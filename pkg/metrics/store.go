@@ -0,0 +1,203 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Sample is a single series value with label values ordered as the family label names
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+// Store is a collector of metrics published by jobs.
+// Every owner replaces all of its series on the first Set of a job run, so series that a later run no longer produces are dropped.
+// Further Sets of the same run, e.g. of a metric step inside an array, add to them.
+type Store struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+type family struct {
+	help       string
+	valueType  prometheus.ValueType
+	labelNames []string
+	series     map[Owner]*ownedSeries
+}
+
+type ownedSeries struct {
+	run    uint64
+	series map[string]Sample
+}
+
+// Owner identifies the producer of a set of series within a metric family
+type Owner struct {
+	Job string
+	// Step is the path of the step within the job, see StepFrom
+	Step string
+}
+
+// DefaultStore is the store served on /metrics
+var DefaultStore = NewStore()
+
+func init() {
+	Registry.MustRegister(DefaultStore)
+}
+
+func NewStore() *Store {
+	return &Store{
+		families: make(map[string]*family),
+	}
+}
+
+// Set replaces the series of owner in the metric family name, or adds to them if they were set by the same run.
+// Run 0 is not a job run, its series always replace the previous ones.
+func (this *Store) Set(owner Owner, run uint64, name, help string, valueType prometheus.ValueType, labelNames []string, samples []Sample) error {
+	if strings.HasPrefix(name, namespace+"_") {
+		return fmt.Errorf("metric %s: names starting with %s_ are reserved for the exporter's own metrics", name, namespace)
+	}
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	f := this.families[name]
+	if f != nil && (f.help != help || f.valueType != valueType || !slices.Equal(f.labelNames, labelNames)) {
+		for o := range f.series {
+			if o != owner {
+				return fmt.Errorf("metric %s is already defined with different help, type or labels by job %s", name, o.Job)
+			}
+		}
+		f = nil
+	}
+	if f == nil {
+		f = &family{
+			help:       help,
+			valueType:  valueType,
+			labelNames: slices.Clone(labelNames),
+			series:     make(map[Owner]*ownedSeries),
+		}
+		this.families[name] = f
+	}
+
+	for _, s := range samples {
+		if len(s.LabelValues) != len(labelNames) {
+			return fmt.Errorf("metric %s: expected %d label values, got %d", name, len(labelNames), len(s.LabelValues))
+		}
+	}
+	owned := f.series[owner]
+	if owned == nil || run == 0 || owned.run != run {
+		owned = &ownedSeries{run: run, series: make(map[string]Sample, len(samples))}
+		f.series[owner] = owned
+	}
+	for _, s := range samples {
+		owned.series[strings.Join(s.LabelValues, "\xff")] = s
+	}
+	return nil
+}
+
+// Forget drops every series produced by job
+func (this *Store) Forget(job string) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	for name, f := range this.families {
+		for o := range f.series {
+			if o.Job == job {
+				delete(f.series, o)
+			}
+		}
+		if len(f.series) == 0 {
+			delete(this.families, name)
+		}
+	}
+}
+
+// Describe sends no descriptors, which makes Store an unchecked collector as its families change at runtime
+func (this *Store) Describe(chan<- *prometheus.Desc) {}
+
+func (this *Store) Collect(ch chan<- prometheus.Metric) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	for name, f := range this.families {
+		desc := prometheus.NewDesc(name, f.help, f.labelNames, nil)
+		seen := make(map[string]bool)
+		for _, owned := range f.series {
+			for key, s := range owned.series {
+				// two owners may produce the same series, only the first one is exposed
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				m, err := prometheus.NewConstMetric(desc, f.valueType, s.Value, s.LabelValues...)
+				if err != nil {
+					log.Printf("[ERROR] skipping series of metric %s: %v\n", name, err)
+					continue
+				}
+				ch <- m
+			}
+		}
+	}
+}
+
+type storeKey struct{}
+
+// WithStore makes metric steps running under ctx publish into store instead of DefaultStore
+func WithStore(ctx context.Context, store *Store) context.Context {
+	return context.WithValue(ctx, storeKey{}, store)
+}
+
+// StoreFrom returns the store set by WithStore or DefaultStore
+func StoreFrom(ctx context.Context) *Store {
+	if store, ok := ctx.Value(storeKey{}).(*Store); ok {
+		return store
+	}
+	return DefaultStore
+}
+
+type jobKey struct{}
+
+type runKey struct{}
+
+type stepKey struct{}
+
+var runs atomic.Uint64
+
+// WithJob annotates ctx with the name of the job being run, every call starts a new run
+func WithJob(ctx context.Context, job string) context.Context {
+	ctx = context.WithValue(ctx, jobKey{}, job)
+	return context.WithValue(ctx, runKey{}, runs.Add(1))
+}
+
+// JobFrom returns the job name set by WithJob
+func JobFrom(ctx context.Context) string {
+	job, _ := ctx.Value(jobKey{}).(string)
+	return job
+}
+
+// RunFrom returns the run started by WithJob or 0
+func RunFrom(ctx context.Context) uint64 {
+	run, _ := ctx.Value(runKey{}).(uint64)
+	return run
+}
+
+// WithStep annotates ctx with the index of the step being run, nested steps extend the path of their parent
+func WithStep(ctx context.Context, index int) context.Context {
+	step := strconv.Itoa(index)
+	if parent := StepFrom(ctx); parent != "" {
+		step = parent + "/" + step
+	}
+	return context.WithValue(ctx, stepKey{}, step)
+}
+
+// StepFrom returns the step path set by WithStep, e.g. "2/0" for the first step of a sequence run as third step of a job
+func StepFrom(ctx context.Context) string {
+	step, _ := ctx.Value(stepKey{}).(string)
+	return step
+}
@@ -1,8 +1,11 @@
 package runner
 
 import (
+	"fmt"
 	"time"
 
+	"github.com/robfig/cron/v3"
+	"github.com/vitrevance/api-exporter/pkg/secret"
 	"github.com/vitrevance/api-exporter/pkg/transformer"
 	"gopkg.in/yaml.v3"
 )
@@ -10,44 +13,192 @@ import (
 type JobConfig struct {
 	JobName     string                          `yaml:"job_name"`
 	RunInterval time.Duration                   `yaml:"interval"`
+	Schedule    string                          `yaml:"schedule"`
+	Timezone    string                          `yaml:"timezone"`
+	Jitter      time.Duration                   `yaml:"jitter"`
+	RunOnStart  *bool                           `yaml:"run_on_start"`
+	Timeout     time.Duration                   `yaml:"timeout"`
+	Probe       bool                            `yaml:"probe"`
 	Steps       []transformer.TransformerConfig `yaml:"steps"`
+
+	schedule cron.Schedule
+	location *time.Location
+	// hash identifies the job along with the transformers it uses, set when decoded as part of a Config
+	hash string
+}
+
+func (this *JobConfig) UnmarshalYAML(value *yaml.Node) error {
+	type plain JobConfig
+	err := transformer.DecodeConfig(value, (*plain)(this))
+	if err != nil {
+		return err
+	}
+	if this.Jitter < 0 {
+		return fmt.Errorf("job %s: jitter must not be negative", this.JobName)
+	}
+	if this.Timeout < 0 {
+		return fmt.Errorf("job %s: timeout must not be negative", this.JobName)
+	}
+	if this.Probe && (this.RunInterval != 0 || this.Schedule != "" || this.RunOnStart != nil) {
+		return fmt.Errorf("job %s: probe jobs run on request only and cannot have interval, schedule or run_on_start", this.JobName)
+	}
+	if this.Schedule == "" {
+		if this.Timezone != "" {
+			return fmt.Errorf("job %s: timezone requires schedule", this.JobName)
+		}
+		return nil
+	}
+	if this.RunInterval != 0 {
+		return fmt.Errorf("job %s: interval and schedule are mutually exclusive", this.JobName)
+	}
+	this.schedule, err = cronParser.Parse(this.Schedule)
+	if err != nil {
+		return fmt.Errorf("job %s: invalid schedule %q: %w", this.JobName, this.Schedule, err)
+	}
+	this.location = time.UTC
+	if this.Timezone != "" {
+		this.location, err = time.LoadLocation(this.Timezone)
+		if err != nil {
+			return fmt.Errorf("job %s: invalid timezone %q: %w", this.JobName, this.Timezone, err)
+		}
+	}
+	return nil
+}
+
+// configFile lists the top-level keys of a config file
+type configFile struct {
+	Include      []string             `yaml:"include"`
+	Strict       *bool                `yaml:"strict"`
+	Redact       []secret.Rule        `yaml:"redact"`
+	Transformers map[string]yaml.Node `yaml:"transformers"`
+	Jobs         []yaml.Node          `yaml:"jobs"`
 }
 
 type Config struct {
 	Transformers map[string]transformer.Transformer `yaml:"-"`
 	Jobs         []JobConfig                        `yaml:"-"`
+	// Redact are rules applied with secret.SetRules when the config is used
+	Redact []secret.Rule `yaml:"-"`
+	// Secrets are the values of ${env:...} and ${file:...} references, passed to secret.SetRules along with Redact
+	Secrets []string `yaml:"-"`
+}
+
+// Job returns the job named name
+func (this *Config) Job(name string) (JobConfig, bool) {
+	for _, job := range this.Jobs {
+		if job.JobName == name {
+			return job, true
+		}
+	}
+	return JobConfig{}, false
 }
 
 func (this *Config) UnmarshalYAML(value *yaml.Node) error {
+	if include := mappingKey(value, "include"); include.Line > 0 {
+		return fmt.Errorf("line %d: include requires loading the config with LoadConfig", include.Line)
+	}
+	return this.decode([]configSource{{doc: value}})
+}
+
+// decode merges jobs and transformers of sources, names of both must be unique across all of them.
+// Nothing global changes, so a config failing to decode leaves the running one intact.
+func (this *Config) decode(sources []configSource) error {
 	this.Transformers = make(map[string]transformer.Transformer)
+	this.Jobs = nil
+	this.Redact = nil
+	this.Secrets = nil
+	err := transformer.WithAliases(func(aliases *transformer.Aliases) error {
+		docs := make([]*yaml.Node, len(sources))
+		files := make([]configFile, len(sources))
+		transformerSources := make(map[string]configSource)
+		transformerNodes := make(map[string]*yaml.Node)
+		for i, src := range sources {
+			doc, err := src.parse()
+			if err != nil {
+				return err
+			}
+			if doc == nil {
+				continue
+			}
+			resolved, errs := secret.Interpolate(doc)
+			this.Secrets = append(this.Secrets, resolved...)
+			if len(errs) > 0 {
+				return src.wrap(errs[0])
+			}
+			docs[i] = doc
+			err = withStrictness(doc, func() error {
+				return transformer.DecodeConfig(doc, &files[i])
+			})
+			if err != nil {
+				return src.wrap(err)
+			}
+			for name := range files[i].Transformers {
+				line := mappingKey(mappingValue(doc, "transformers"), name).Line
+				if first, ok := transformerSources[name]; ok {
+					return fmt.Errorf("%s: duplicate transformer %q, first defined in %s", src.position(line), name, first.name)
+				}
+				transformerSources[name] = src
+				node := files[i].Transformers[name]
+				transformerNodes[name] = &node
+				if err := aliases.Add(name); err != nil {
+					return src.wrap(fmt.Errorf("line %d: %w", line, err))
+				}
+			}
+			this.Redact = append(this.Redact, files[i].Redact...)
+		}
 
-	type helperT struct {
-		Transformers map[string]*yaml.Node `yaml:"transformers"`
-	}
-	transformers := helperT{}
-	err := value.Decode(&transformers)
-	if err != nil {
-		return err
-	}
-	for k, _ := range transformers.Transformers {
-		err = transformer.RegisterTransformerFactory(k, transformer.NewAliasTransformerFactory(k))
-		if err != nil {
-			return err
+		jobSources := make(map[string]string)
+		for i, src := range sources {
+			doc := docs[i]
+			if doc == nil {
+				continue
+			}
+			err := withStrictness(doc, func() error {
+				for name, node := range files[i].Transformers {
+					var tc transformer.TransformerConfig
+					if err := node.Decode(&tc); err != nil {
+						return err
+					}
+					this.Transformers[name] = tc.Transformer
+				}
+				for _, node := range files[i].Jobs {
+					var job JobConfig
+					if err := node.Decode(&job); err != nil {
+						return err
+					}
+					line := mappingKey(&node, "job_name").Line
+					if first, ok := jobSources[job.JobName]; ok {
+						return fmt.Errorf("line %d: duplicate job_name %q, first defined at %s", line, job.JobName, first)
+					}
+					jobSources[job.JobName] = src.position(line)
+					job.hash = jobHash(&node, transformerNodes)
+					this.Jobs = append(this.Jobs, job)
+				}
+				return nil
+			})
+			if err != nil {
+				return src.wrap(err)
+			}
 		}
-	}
+		return nil
+	})
+	// secrets of the config are not redacted by the log yet
+	return secret.ErrorWith(err, this.Secrets)
+}
 
-	type helper struct {
-		Transformers map[string]transformer.TransformerConfig `yaml:"transformers"`
-		Jobs         []JobConfig                              `yaml:"jobs"`
+// withStrictness runs decode with strict decoding turned off if doc says `strict: false`,
+// which keeps configs written before unknown fields were rejected working
+func withStrictness(doc *yaml.Node, decode func() error) error {
+	var options struct {
+		Strict *bool `yaml:"strict"`
 	}
-	h := helper{}
-	err = value.Decode(&h)
-	if err != nil {
+	if err := doc.Decode(&options); err != nil {
 		return err
 	}
-	for k, v := range h.Transformers {
-		this.Transformers[k] = v.Transformer
+	if options.Strict != nil {
+		strict := transformer.StrictDecoding()
+		transformer.SetStrictDecoding(*options.Strict)
+		defer transformer.SetStrictDecoding(strict)
 	}
-	this.Jobs = h.Jobs
-	return nil
+	return decode()
 }
@@ -0,0 +1,220 @@
+package runner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vitrevance/api-exporter/pkg/fread"
+	"github.com/vitrevance/api-exporter/pkg/secret"
+	"gopkg.in/yaml.v3"
+)
+
+// configSource is a config file, configs decoded with yaml.Unmarshal have no name and are already parsed
+type configSource struct {
+	name string
+	data []byte
+	doc  *yaml.Node
+}
+
+// parse returns the top-level mapping of the source or nil if it is empty
+func (this configSource) parse() (*yaml.Node, error) {
+	if this.doc != nil {
+		return this.doc, nil
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(this.data, &root); err != nil {
+		return nil, this.wrap(err)
+	}
+	if len(root.Content) == 0 {
+		return nil, nil
+	}
+	return root.Content[0], nil
+}
+
+func (this configSource) wrap(err error) error {
+	if this.name == "" || err == nil {
+		return err
+	}
+	return fmt.Errorf("%s: %w", this.name, err)
+}
+
+// position formats line of the source for messages about other sources
+func (this configSource) position(line int) string {
+	if this.name == "" {
+		return fmt.Sprintf("line %d", line)
+	}
+	return fmt.Sprintf("%s:%d", this.name, line)
+}
+
+// ConfigFiles are the files of a config with includes resolved, in the order their jobs are loaded
+type ConfigFiles struct {
+	sources []configSource
+	// Hash changes whenever any of the files does
+	Hash string
+	// resolved is the hash of values of ${env:...} and ${file:...} references, kept out of Hash as it is exposed
+	resolved string
+}
+
+// Same reports whether other has the same files whose references resolve to the same values
+func (this *ConfigFiles) Same(other *ConfigFiles) bool {
+	return other != nil && this.Hash == other.Hash && this.resolved == other.resolved
+}
+
+// Paths returns paths and URLs of the files
+func (this *ConfigFiles) Paths() []string {
+	paths := make([]string, len(this.sources))
+	for i, src := range this.sources {
+		paths[i] = src.name
+	}
+	return paths
+}
+
+// Decode decodes jobs and transformers of all files into one config
+func (this *ConfigFiles) Decode() (*Config, error) {
+	cfg := &Config{}
+	if err := cfg.decode(this.sources); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadConfig reads the config at path, a file, a directory of *.yaml files or an http url, along with its includes
+func LoadConfig(path string) (*Config, error) {
+	files, err := ReadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	return files.Decode()
+}
+
+// ReadConfig reads the files of the config at path without decoding them.
+// Includes are resolved relative to the including file, a file included twice is read once.
+func ReadConfig(path string) (*ConfigFiles, error) {
+	reader := &configReader{seen: make(map[string]bool), files: &ConfigFiles{}}
+	if err := reader.read(path); err != nil {
+		return nil, err
+	}
+	hash := sha256.New()
+	for _, src := range reader.files.sources {
+		fmt.Fprintf(hash, "%s\n%d\n", src.name, len(src.data))
+		hash.Write(src.data)
+	}
+	reader.files.Hash = hex.EncodeToString(hash.Sum(nil))
+
+	resolved := sha256.New()
+	for _, src := range reader.files.sources {
+		doc, err := src.parse()
+		if err != nil || doc == nil {
+			continue
+		}
+		// errors are reported by Decode
+		values, _ := secret.Interpolate(doc)
+		for _, v := range values {
+			fmt.Fprintf(resolved, "%d\n%s", len(v), v)
+		}
+	}
+	reader.files.resolved = hex.EncodeToString(resolved.Sum(nil))
+	return reader.files, nil
+}
+
+type configReader struct {
+	seen  map[string]bool
+	files *ConfigFiles
+}
+
+func (this *configReader) read(path string) error {
+	if !fread.IsHTTPURL(path) {
+		path = filepath.Clean(path)
+	}
+	if this.seen[path] {
+		return nil
+	}
+	this.seen[path] = true
+
+	if !fread.IsHTTPURL(path) {
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			return this.readDir(path)
+		}
+	}
+	data, err := fread.ReadFileOrHTTP(path)
+	if err != nil {
+		return err
+	}
+	src := configSource{name: path, data: data}
+	this.files.sources = append(this.files.sources, src)
+
+	doc, err := src.parse()
+	if err != nil || doc == nil {
+		return err
+	}
+	var includes struct {
+		Include []string `yaml:"include"`
+	}
+	if err := doc.Decode(&includes); err != nil {
+		return src.wrap(err)
+	}
+	for _, include := range includes.Include {
+		paths, err := resolveInclude(path, include)
+		if err != nil {
+			return src.wrap(err)
+		}
+		for _, p := range paths {
+			if err := this.read(p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readDir reads *.yaml and *.yml files of dir in lexical order, subdirectories are not read
+func (this *configReader) readDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("cannot read %q: %w", dir, err)
+	}
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		if err := this.read(filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveInclude resolves include relative to the file base, local globs expand to their sorted matches
+func resolveInclude(base, include string) ([]string, error) {
+	if fread.IsHTTPURL(include) {
+		return []string{include}, nil
+	}
+	if fread.IsHTTPURL(base) {
+		baseURL, err := url.Parse(base)
+		if err != nil {
+			return nil, err
+		}
+		ref, err := url.Parse(include)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include %q: %w", include, err)
+		}
+		return []string{baseURL.ResolveReference(ref).String()}, nil
+	}
+	if !filepath.IsAbs(include) {
+		include = filepath.Join(filepath.Dir(base), include)
+	}
+	if !strings.ContainsAny(include, "*?[") {
+		return []string{include}, nil
+	}
+	matches, err := filepath.Glob(include)
+	if err != nil {
+		return nil, fmt.Errorf("invalid include %q: %w", include, err)
+	}
+	return matches, nil
+}
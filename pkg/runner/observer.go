@@ -0,0 +1,25 @@
+package runner
+
+import (
+	"context"
+
+	"github.com/vitrevance/api-exporter/pkg/transformer"
+)
+
+// StepObserver is notified around every step run by RunJob, e.g. to trace a job
+type StepObserver interface {
+	BeforeStep(job string, index int, step transformer.TransformerConfig, ctx *transformer.TransformationContext)
+	AfterStep(job string, index int, step transformer.TransformerConfig, ctx *transformer.TransformationContext, err error)
+}
+
+type observerKey struct{}
+
+// WithObserver makes RunJob notify observer about steps of jobs run under ctx
+func WithObserver(ctx context.Context, observer StepObserver) context.Context {
+	return context.WithValue(ctx, observerKey{}, observer)
+}
+
+func observerFrom(ctx context.Context) StepObserver {
+	observer, _ := ctx.Value(observerKey{}).(StepObserver)
+	return observer
+}
@@ -0,0 +1,83 @@
+package runner
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/vitrevance/api-exporter/pkg/metrics"
+)
+
+const (
+	// defaultProbeTimeout applies when the scraper does not send its timeout
+	defaultProbeTimeout = 10 * time.Second
+	// probeTimeoutOffset leaves time to write the response before the scraper gives up
+	probeTimeoutOffset = 500 * time.Millisecond
+)
+
+// ProbeHandler runs the probe job given by the job query parameter of /probe?job=<job_name>&target=<url>
+// and responds with the metrics published by that single run.
+// All query parameters are passed to the first step as an object. config returns the currently loaded config.
+func ProbeHandler(config func() *Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		name := params.Get("job")
+		if name == "" {
+			http.Error(w, "job parameter is missing", http.StatusBadRequest)
+			return
+		}
+		cfg := config()
+		if cfg == nil {
+			http.Error(w, "config is not loaded", http.StatusServiceUnavailable)
+			return
+		}
+		job, ok := cfg.Job(name)
+		if !ok || !job.Probe {
+			http.Error(w, "unknown probe job "+strconv.Quote(name), http.StatusNotFound)
+			return
+		}
+
+		timeout := defaultProbeTimeout
+		if v := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"); v != "" {
+			seconds, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				http.Error(w, "invalid X-Prometheus-Scrape-Timeout-Seconds: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			timeout = time.Duration(seconds * float64(time.Second))
+			if timeout > probeTimeoutOffset {
+				timeout -= probeTimeoutOffset
+			}
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		object := make(map[string]any, len(params))
+		for k, v := range params {
+			object[k] = v[0]
+		}
+
+		store := metrics.NewStore()
+		probeSuccess := prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "probe_success",
+			Help: "Whether the probe job finished without errors.",
+		})
+		probeDuration := prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "probe_duration_seconds",
+			Help: "Duration of the probe job.",
+		})
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(store, probeSuccess, probeDuration)
+
+		start := time.Now()
+		err := cfg.RunJob(metrics.WithStore(ctx, store), job, object)
+		probeDuration.Set(time.Since(start).Seconds())
+		if err == nil {
+			probeSuccess.Set(1)
+		}
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,290 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/vitrevance/api-exporter/pkg/fread"
+	"github.com/vitrevance/api-exporter/pkg/metrics"
+	"github.com/vitrevance/api-exporter/pkg/secret"
+)
+
+const (
+	// reloadDebounce is how long file events are collected before a reload, editors write files in several steps
+	reloadDebounce = 500 * time.Millisecond
+	// reloadRetry is the delay before reading config files is retried after it failed
+	reloadRetry = 5 * time.Second
+)
+
+// Reloader loads the config at a path and then every changed version of it. Reloads are triggered by
+// changes of local config files, calls of Reload and, unless the interval is 0, periodically.
+type Reloader struct {
+	path     string
+	interval time.Duration
+	// Status describes the running config and the outcome of the last reload
+	Status *ReloadStatus
+
+	triggers chan string
+	// forced makes the next reload decode the config even if its files did not change
+	forced atomic.Bool
+}
+
+func NewReloader(path string, interval time.Duration) *Reloader {
+	return &Reloader{
+		path:     path,
+		interval: interval,
+		Status:   &ReloadStatus{},
+		triggers: make(chan string, 1),
+	}
+}
+
+// Reload reloads the config even if it did not change, e.g. on SIGHUP
+func (this *Reloader) Reload(reason string) {
+	this.forced.Store(true)
+	this.trigger(reason)
+}
+
+func (this *Reloader) trigger(reason string) {
+	select {
+	case this.triggers <- reason:
+	default:
+	}
+}
+
+// Start loads the config and returns the channel it and every changed version are sent to until ctx is done
+func (this *Reloader) Start(ctx context.Context) <-chan *Config {
+	ch := make(chan *Config)
+
+	if this.interval > 0 {
+		go func() {
+			ticker := time.NewTicker(this.interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					this.trigger("interval")
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	watcher, err := newConfigWatcher(this.path, func() {
+		this.trigger("file change")
+	})
+	if err != nil {
+		log.Printf("[ERROR] cannot watch config files, reloading on SIGHUP only: %v", err)
+	}
+
+	go func() {
+		if watcher != nil {
+			defer watcher.close()
+		}
+		// last are the files of the last config tried, unchanged ones are not decoded again unless that failed
+		var last *ConfigFiles
+		lastFailed := false
+		load := func() {
+			forced := this.forced.Swap(false)
+			files, err := ReadConfig(this.path)
+			if err != nil {
+				log.Printf("[ERROR] failed to reload config file: %v", err)
+				this.Status.failed(err)
+				time.AfterFunc(reloadRetry, func() {
+					this.trigger("retry")
+				})
+				return
+			}
+			if watcher != nil {
+				watcher.watch(files.Paths())
+			}
+
+			if files.Same(last) && !lastFailed && !forced {
+				log.Println("[INFO] reloaded config with no changes")
+				return
+			}
+			last = files
+
+			// the new config is fully built before it replaces the running one
+			cfg, err := files.Decode()
+			lastFailed = err != nil
+			if err != nil {
+				log.Printf("[ERROR] failed to read config, keeping the previous one: %v", err)
+				this.Status.failed(err)
+				return
+			}
+			log.Printf("[INFO] loaded config %s from %d file(s)", files.Hash[:12], len(files.Paths()))
+			this.Status.loaded(files, len(cfg.Jobs))
+			select {
+			case ch <- cfg:
+			case <-ctx.Done():
+			}
+		}
+
+		load()
+		for {
+			select {
+			case reason := <-this.triggers:
+				log.Printf("[INFO] reloading config on %s", reason)
+				load()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// ReloadStatus describes the running config and the outcome of the last reload, it is served on /status
+type ReloadStatus struct {
+	mu sync.Mutex
+
+	ConfigHash string    `json:"config_hash"`
+	Files      []string  `json:"files"`
+	Jobs       int       `json:"jobs"`
+	LoadedAt   time.Time `json:"loaded_at"`
+
+	LastReload        time.Time `json:"last_reload"`
+	LastReloadSuccess bool      `json:"last_reload_success"`
+	LastReloadError   string    `json:"last_reload_error,omitempty"`
+}
+
+func (this *ReloadStatus) loaded(files *ConfigFiles, jobs int) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	now := time.Now()
+	this.ConfigHash = files.Hash
+	this.Files = files.Paths()
+	this.Jobs = jobs
+	this.LoadedAt = now
+	this.LastReload = now
+	this.LastReloadSuccess = true
+	this.LastReloadError = ""
+
+	metrics.ConfigInfo.Reset()
+	metrics.ConfigInfo.WithLabelValues(files.Hash).Set(1)
+	metrics.ConfigLastReload.SetToCurrentTime()
+	metrics.ConfigReloads.WithLabelValues("success").Inc()
+	metrics.ConfigLastReloadSuccessful.Set(1)
+}
+
+func (this *ReloadStatus) failed(err error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.LastReload = time.Now()
+	this.LastReloadSuccess = false
+	this.LastReloadError = secret.Redact(err.Error())
+
+	metrics.ConfigReloads.WithLabelValues("failure").Inc()
+	metrics.ConfigLastReloadSuccessful.Set(0)
+}
+
+func (this *ReloadStatus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	this.mu.Lock()
+	data, err := json.MarshalIndent(this, "", "  ")
+	running := this.ConfigHash != ""
+	this.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !running {
+		// a failed reload keeps the previous config running, only having none at all is unavailable
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write(data)
+}
+
+// configWatcher calls onChange once events on watched config files settle
+type configWatcher struct {
+	watcher *fsnotify.Watcher
+
+	mu    sync.Mutex
+	dirs  map[string]bool
+	files map[string]bool
+}
+
+func newConfigWatcher(path string, onChange func()) (*configWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	this := &configWatcher{
+		watcher: watcher,
+		dirs:    make(map[string]bool),
+		files:   make(map[string]bool),
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		this.add(filepath.Clean(path))
+	}
+
+	debounce := time.AfterFunc(time.Hour, onChange)
+	debounce.Stop()
+	go func() {
+		defer debounce.Stop()
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op != fsnotify.Chmod && this.relevant(event.Name) {
+					debounce.Reset(reloadDebounce)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("[ERROR] config watcher: %v", err)
+			}
+		}
+	}()
+	return this, nil
+}
+
+// watch watches directories of the local ones of paths, so that files replaced by renames are noticed too
+func (this *configWatcher) watch(paths []string) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	for _, path := range paths {
+		if fread.IsHTTPURL(path) {
+			continue
+		}
+		this.files[path] = true
+		this.add(filepath.Dir(path))
+	}
+}
+
+func (this *configWatcher) add(dir string) {
+	if this.dirs[dir] {
+		return
+	}
+	if err := this.watcher.Add(dir); err != nil {
+		log.Printf("[ERROR] cannot watch %s: %v", dir, err)
+		return
+	}
+	this.dirs[dir] = true
+}
+
+// relevant reports whether name is a config file or a new file that a directory or glob may load
+func (this *configWatcher) relevant(name string) bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	ext := filepath.Ext(name)
+	return this.files[filepath.Clean(name)] || ext == ".yaml" || ext == ".yml"
+}
+
+func (this *configWatcher) close() {
+	if err := this.watcher.Close(); err != nil {
+		log.Printf("[ERROR] config watcher: %v", err)
+	}
+}
@@ -2,49 +2,103 @@ package runner
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"strconv"
+	"time"
 
+	"github.com/vitrevance/api-exporter/pkg/metrics"
+	"github.com/vitrevance/api-exporter/pkg/secret"
 	"github.com/vitrevance/api-exporter/pkg/transformer"
 )
 
 func (this *Config) RunJobs(ctx context.Context) {
 	for _, job := range this.Jobs {
-		go func() {
-			for {
-				log.Println("Starting job", job.JobName)
-				tctx := &transformer.TransformationContext{
-					Object:       make(map[string]any),
-					Result:       make(map[string]any),
-					Transformers: this.Transformers,
-				}
-				for i, step := range job.Steps {
-					if !step.KeepContext {
-						tctx = &transformer.TransformationContext{
-							Object:       tctx.Result,
-							Result:       make(map[string]any),
-							Transformers: this.Transformers,
-						}
-					}
-					err := step.Transformer.Transform(tctx)
-					if err != nil {
-						log.Printf("[ERROR] step [%d] failed: %v\n", i, err)
-						break
-					}
-					log.Printf("[INFO] step [%d] finished\n", i)
-				}
-				log.Println("Finished job", job.JobName)
-				if job.RunInterval == 0 {
-					return
-				}
-				timeout, cancel := context.WithTimeout(context.Background(), job.RunInterval)
-				select {
-				case <-ctx.Done():
-					cancel()
-					return
-				case <-timeout.Done():
-					cancel()
-				}
+		if job.Probe {
+			continue
+		}
+		go this.schedule(ctx, ctx, job)
+	}
+}
+
+// schedule runs job at its times until schedCtx is done, the runs themselves are governed by runCtx
+func (this *Config) schedule(schedCtx, runCtx context.Context, job JobConfig) {
+	if !job.ShouldRunOnStart() {
+		next, ok := job.NextRun(time.Now())
+		if !ok || !sleepUntil(schedCtx, next) {
+			return
+		}
+	}
+	for {
+		this.RunJob(runCtx, job, make(map[string]any))
+		next, ok := job.NextRun(time.Now())
+		if !ok || !sleepUntil(schedCtx, next) {
+			return
+		}
+	}
+}
+
+// RunJob executes all steps of job once, object is passed to the first step.
+// The returned error is the one of the failed step, the run is also logged and recorded in metrics.
+func (this *Config) RunJob(ctx context.Context, job JobConfig, object any) error {
+	// cancelling the run on return also releases response bodies of streams nobody consumed
+	var cancel context.CancelFunc
+	if job.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, job.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+	ctx = metrics.WithJob(ctx, job.JobName)
+	log.Println("Starting job", job.JobName)
+	start := time.Now()
+	var jobErr error
+	tctx := &transformer.TransformationContext{
+		Context:      ctx,
+		Object:       object,
+		Result:       make(map[string]any),
+		Transformers: this.Transformers,
+	}
+	for i, step := range job.Steps {
+		if ctx.Err() != nil {
+			jobErr = fmt.Errorf("step [%d] not started: %w", i, ctx.Err())
+			log.Printf("[ERROR] %v\n", jobErr)
+			break
+		}
+		if !step.KeepContext && i > 0 {
+			tctx = &transformer.TransformationContext{
+				Context:      ctx,
+				Object:       tctx.Result,
+				Result:       make(map[string]any),
+				Transformers: this.Transformers,
 			}
-		}()
+		}
+		tctx.Context = metrics.WithStep(ctx, i)
+		observer := observerFrom(ctx)
+		if observer != nil {
+			observer.BeforeStep(job.JobName, i, step, tctx)
+		}
+		stepStart := time.Now()
+		err := step.Transformer.Transform(tctx)
+		if observer != nil {
+			observer.AfterStep(job.JobName, i, step, tctx, err)
+		}
+		metrics.StepDuration.WithLabelValues(job.JobName, strconv.Itoa(i), step.Type).Observe(time.Since(stepStart).Seconds())
+		if err != nil {
+			jobErr = secret.Error(fmt.Errorf("step [%d] failed: %w", i, err))
+			log.Printf("[ERROR] %v\n", jobErr)
+			metrics.StepFailures.WithLabelValues(job.JobName, strconv.Itoa(i), step.Type).Inc()
+			break
+		}
+		log.Printf("[INFO] step [%d] finished\n", i)
+	}
+	metrics.JobDuration.WithLabelValues(job.JobName).Observe(time.Since(start).Seconds())
+	if jobErr != nil {
+		metrics.JobRuns.WithLabelValues(job.JobName, "failure").Inc()
+	} else {
+		metrics.JobRuns.WithLabelValues(job.JobName, "success").Inc()
+		metrics.JobLastSuccess.WithLabelValues(job.JobName).SetToCurrentTime()
 	}
+	log.Println("Finished job", job.JobName)
+	return jobErr
 }
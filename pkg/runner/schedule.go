@@ -0,0 +1,54 @@
+package runner
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// cronParser accepts standard 5-field expressions with an optional leading seconds field and descriptors like @daily
+var cronParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// NextRun returns the time of the next run after a run that finished at last.
+// The second return value is false when the job is not recurring.
+func (this *JobConfig) NextRun(last time.Time) (time.Time, bool) {
+	var next time.Time
+	switch {
+	case this.schedule != nil:
+		next = this.schedule.Next(last.In(this.location))
+		if next.IsZero() {
+			return next, false
+		}
+	case this.RunInterval != 0:
+		next = last.Add(this.RunInterval)
+	default:
+		return next, false
+	}
+	if this.Jitter > 0 {
+		next = next.Add(time.Duration(rand.Int63n(int64(this.Jitter))))
+	}
+	return next, true
+}
+
+// ShouldRunOnStart reports whether the job runs immediately when started.
+// Interval jobs run on start by default, scheduled jobs wait for their first slot.
+func (this *JobConfig) ShouldRunOnStart() bool {
+	if this.RunOnStart != nil {
+		return *this.RunOnStart
+	}
+	return this.schedule == nil
+}
+
+// sleepUntil blocks until t or until ctx is done, returns false in the latter case
+func sleepUntil(ctx context.Context, t time.Time) bool {
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,265 @@
+package runner
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/vitrevance/api-exporter/pkg/metrics"
+	"gopkg.in/yaml.v3"
+)
+
+// Scheduler runs the jobs of a config. Applying a new config restarts only the jobs that were added, removed
+// or changed, including changes of transformers they use, so other jobs keep their schedules and runs.
+type Scheduler struct {
+	// DrainTimeout limits how long a stopped job may finish its current run before the run is cancelled
+	DrainTimeout time.Duration
+
+	ctx  context.Context
+	mu   sync.Mutex
+	jobs map[string]*scheduledJob
+	// draining are stopped jobs that did not finish yet
+	draining map[*scheduledJob]string
+	closed   bool
+}
+
+type scheduledJob struct {
+	hash string
+	// stop ends scheduling, cancel also cancels the current run
+	stop   context.CancelFunc
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewScheduler creates a scheduler whose runs are cancelled along with ctx
+func NewScheduler(ctx context.Context, drainTimeout time.Duration) *Scheduler {
+	return &Scheduler{
+		DrainTimeout: drainTimeout,
+		ctx:          ctx,
+		jobs:         make(map[string]*scheduledJob),
+		draining:     make(map[*scheduledJob]string),
+	}
+}
+
+// Apply makes the jobs of cfg run. Stopped jobs finish their current run in the background,
+// the new version of a changed or re-added job starts once all older ones are done and their series are dropped.
+func (this *Scheduler) Apply(cfg *Config) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.closed {
+		return
+	}
+	next := make(map[string]*scheduledJob)
+	for _, job := range cfg.Jobs {
+		if job.Probe {
+			continue
+		}
+		old := this.jobs[job.JobName]
+		delete(this.jobs, job.JobName)
+		if old != nil && old.hash == job.hash {
+			next[job.JobName] = old
+			continue
+		}
+		var after <-chan struct{}
+		if old != nil {
+			log.Printf("[INFO] job %s changed, restarting it", job.JobName)
+			this.drain(job.JobName, old)
+			after = old.done
+		} else {
+			log.Printf("[INFO] job %s added", job.JobName)
+			// a removed version may still be running, a job added again waits for it like a changed one
+			after = this.drainingJob(job.JobName)
+		}
+		next[job.JobName] = this.start(cfg, job, after)
+	}
+	for name, old := range this.jobs {
+		log.Printf("[INFO] job %s removed", name)
+		this.drain(name, old)
+		go func() {
+			<-old.done
+			this.mu.Lock()
+			defer this.mu.Unlock()
+			// the job may have been added again meanwhile
+			if this.jobs[name] == nil {
+				metrics.ForgetJob(name)
+			}
+		}()
+	}
+	this.jobs = next
+}
+
+func (this *Scheduler) start(cfg *Config, job JobConfig, after <-chan struct{}) *scheduledJob {
+	schedCtx, stop := context.WithCancel(this.ctx)
+	runCtx, cancel := context.WithCancel(this.ctx)
+	sj := &scheduledJob{hash: job.hash, stop: stop, cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(sj.done)
+		defer cancel()
+		if after != nil {
+			select {
+			case <-after:
+			case <-schedCtx.Done():
+				// a newer version waits on this one, so it must not be done before the older ones
+				<-after
+				return
+			}
+			// the new version may no longer produce series of the old one, e.g. of a removed step
+			metrics.ForgetJob(job.JobName)
+		}
+		cfg.schedule(schedCtx, runCtx, job)
+	}()
+	return sj
+}
+
+// drainingJob returns a channel closed once every stopped version of the job named name is done, or nil if none is running
+func (this *Scheduler) drainingJob(name string) <-chan struct{} {
+	var running []*scheduledJob
+	for sj, n := range this.draining {
+		if n == name {
+			running = append(running, sj)
+		}
+	}
+	if len(running) == 0 {
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, sj := range running {
+			<-sj.done
+		}
+	}()
+	return done
+}
+
+// drain stops scheduling sj and cancels its current run if it does not finish within DrainTimeout
+func (this *Scheduler) drain(name string, sj *scheduledJob) {
+	sj.stop()
+	this.draining[sj] = name
+	go func() {
+		timer := time.NewTimer(this.DrainTimeout)
+		defer timer.Stop()
+		select {
+		case <-sj.done:
+		case <-timer.C:
+			log.Printf("[WARN] job %s did not finish within %s, cancelling it", name, this.DrainTimeout)
+			sj.cancel()
+			<-sj.done
+		}
+		this.mu.Lock()
+		delete(this.draining, sj)
+		this.mu.Unlock()
+	}()
+}
+
+// Shutdown stops scheduling and waits up to timeout for the current runs to finish, later configs are ignored.
+// Runs still going by then are cancelled, the names of their jobs are returned.
+func (this *Scheduler) Shutdown(timeout time.Duration) []string {
+	this.mu.Lock()
+	this.closed = true
+	running := make(map[*scheduledJob]string, len(this.jobs)+len(this.draining))
+	for name, sj := range this.jobs {
+		running[sj] = name
+	}
+	for sj, name := range this.draining {
+		running[sj] = name
+	}
+	this.jobs = make(map[string]*scheduledJob)
+	this.mu.Unlock()
+
+	for sj := range running {
+		sj.stop()
+	}
+	deadline, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var interrupted []string
+	for sj, name := range running {
+		select {
+		case <-sj.done:
+			continue
+		case <-deadline.Done():
+		}
+		select {
+		case <-sj.done:
+			continue
+		default:
+		}
+		interrupted = append(interrupted, name)
+		sj.cancel()
+	}
+	for sj := range running {
+		<-sj.done
+	}
+	slices.Sort(interrupted)
+	return interrupted
+}
+
+// jobHash hashes the job node with every transformer it refers to, directly or through other transformers.
+// References are found by name, so a scalar that happens to equal a transformer name counts too.
+func jobHash(job *yaml.Node, transformers map[string]*yaml.Node) string {
+	hash := sha256.New()
+	writeNode(hash, job)
+
+	used := make(map[string]bool)
+	pending := []*yaml.Node{job}
+	for len(pending) > 0 {
+		node := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		for _, name := range references(node, transformers) {
+			if !used[name] {
+				used[name] = true
+				pending = append(pending, transformers[name])
+			}
+		}
+	}
+	names := make([]string, 0, len(used))
+	for name := range used {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		hash.Write([]byte(name))
+		writeNode(hash, transformers[name])
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// writeNode writes node without its comments, so that editing them does not restart jobs
+func writeNode(hash io.Writer, node *yaml.Node) {
+	data, _ := yaml.Marshal(withoutComments(node))
+	hash.Write(data)
+}
+
+func withoutComments(node *yaml.Node) *yaml.Node {
+	stripped := *node
+	stripped.HeadComment, stripped.LineComment, stripped.FootComment = "", "", ""
+	stripped.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		stripped.Content[i] = withoutComments(child)
+	}
+	return &stripped
+}
+
+// references returns names of transformers used by scalars of node, either as values or in run() calls of scripts
+func references(node *yaml.Node, transformers map[string]*yaml.Node) []string {
+	var names []string
+	if node.Kind == yaml.ScalarNode {
+		if _, ok := transformers[node.Value]; ok {
+			names = append(names, node.Value)
+		}
+		for _, m := range scriptRun.FindAllStringSubmatch(node.Value, -1) {
+			if _, ok := transformers[m[1]]; ok {
+				names = append(names, m[1])
+			}
+		}
+	}
+	for _, child := range node.Content {
+		names = append(names, references(child, transformers)...)
+	}
+	return names
+}
@@ -0,0 +1,279 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/vitrevance/api-exporter/pkg/secret"
+	"github.com/vitrevance/api-exporter/pkg/transformer"
+	"gopkg.in/yaml.v3"
+)
+
+// ValidationError is a problem found in a config file at a YAML position
+type ValidationError struct {
+	// File is empty for configs validated with Validate
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (this ValidationError) Error() string {
+	pos := strconv.Itoa(this.Line)
+	if this.Column != 0 {
+		pos = fmt.Sprintf("%d:%d", this.Line, this.Column)
+	}
+	if this.File != "" {
+		pos = this.File + ":" + pos
+	}
+	return fmt.Sprintf("%s: %s", pos, this.Message)
+}
+
+var (
+	// linePrefix matches positions yaml.v3 and transformer factories put into error messages
+	linePrefix = regexp.MustCompile(`^(?:yaml: )?(?:unmarshal errors:\s*)?line (\d+)(?:, column (\d+))?: `)
+	// scriptRun matches calls of run() with a literal transformer name in javascript steps
+	scriptRun = regexp.MustCompile(`\brun\(\s*["']([^"']+)["']`)
+)
+
+// Validate checks data with strict field checking unless it sets `strict: false` and reports every problem it finds
+// instead of stopping at the first one like loading does. Includes are not followed.
+func Validate(data []byte) []ValidationError {
+	return validate([]configSource{{data: data}})
+}
+
+// ValidateFiles is Validate for a config with includes, names must be unique across all files
+func ValidateFiles(files *ConfigFiles) []ValidationError {
+	return validate(files.sources)
+}
+
+func validate(sources []configSource) []ValidationError {
+	var errs []ValidationError
+	transformer.WithAliases(func(aliases *transformer.Aliases) error {
+		errs = validateSources(sources, aliases)
+		return nil
+	})
+
+	order := make(map[string]int, len(sources))
+	for i, src := range sources {
+		order[src.name] = i
+	}
+	slices.SortStableFunc(errs, func(a, b ValidationError) int {
+		if a.File != b.File {
+			return order[a.File] - order[b.File]
+		}
+		if a.Line != b.Line {
+			return a.Line - b.Line
+		}
+		return a.Column - b.Column
+	})
+	return errs
+}
+
+func validateSources(sources []configSource, aliases *transformer.Aliases) []ValidationError {
+	// files are strict by default even if loading is not, the strict option of each file is still honored
+	strict := transformer.StrictDecoding()
+	transformer.SetStrictDecoding(true)
+	defer transformer.SetStrictDecoding(strict)
+
+	var errs []ValidationError
+	var resolved []string
+	report := func(src configSource, verrs ...ValidationError) {
+		for _, verr := range verrs {
+			verr.File = src.name
+			errs = append(errs, verr)
+		}
+	}
+
+	docs := make([]*yaml.Node, len(sources))
+	files := make([]configFile, len(sources))
+	for i, src := range sources {
+		var root yaml.Node
+		if err := yaml.Unmarshal(src.data, &root); err != nil {
+			report(src, positioned(err, &root))
+			continue
+		}
+		if len(root.Content) == 0 {
+			report(src, ValidationError{Line: 1, Column: 1, Message: "config is empty"})
+			continue
+		}
+		doc := root.Content[0]
+		values, interpolateErrs := secret.Interpolate(doc)
+		resolved = append(resolved, values...)
+		for _, err := range interpolateErrs {
+			report(src, positioned(err, doc))
+		}
+		err := withStrictness(doc, func() error {
+			return transformer.DecodeConfig(doc, &files[i])
+		})
+		if err != nil {
+			report(src, positioned(err, doc))
+			continue
+		}
+		docs[i] = doc
+	}
+
+	transformerSources := make(map[string]string)
+	for i, src := range sources {
+		transformersNode := mappingValue(docs[i], "transformers")
+		for name := range files[i].Transformers {
+			key := mappingKey(transformersNode, name)
+			if first, ok := transformerSources[name]; ok {
+				report(src, ValidationError{Line: key.Line, Column: key.Column, Message: fmt.Sprintf("duplicate transformer %q, first defined in %s", name, first)})
+				continue
+			}
+			transformerSources[name] = src.name
+			if err := aliases.Add(name); err != nil {
+				report(src, ValidationError{Line: key.Line, Column: key.Column, Message: err.Error()})
+			}
+		}
+	}
+
+	jobSources := make(map[string]string)
+	for i, src := range sources {
+		if docs[i] == nil {
+			continue
+		}
+		// the strict option was decoded above already, so there is no error to report
+		_ = withStrictness(docs[i], func() error {
+			for name, node := range files[i].Transformers {
+				node := &node
+				var tc transformer.TransformerConfig
+				if err := node.Decode(&tc); err != nil {
+					report(src, prefixed(positioned(err, node), "transformer "+name))
+				}
+			}
+			for j := range files[i].Jobs {
+				report(src, validateJob(src, &files[i].Jobs[j], j, jobSources)...)
+			}
+			return nil
+		})
+		report(src, checkScripts(docs[i], transformerSources)...)
+	}
+	// messages may quote values of the config's secrets
+	for i := range errs {
+		errs[i].Message = secret.RedactWith(errs[i].Message, resolved)
+	}
+	return errs
+}
+
+// validateJob checks the job node with index i of src, jobSources maps names of checked jobs to their positions
+func validateJob(src configSource, node *yaml.Node, i int, jobSources map[string]string) []ValidationError {
+	var errs []ValidationError
+	name := fmt.Sprintf("[%d]", i)
+	if v := mappingValue(node, "job_name"); v != nil && v.Value != "" {
+		name = v.Value
+		if first, ok := jobSources[name]; ok {
+			errs = append(errs, ValidationError{Line: v.Line, Column: v.Column, Message: fmt.Sprintf("duplicate job_name %q, first defined at %s", name, first)})
+		} else {
+			jobSources[name] = src.position(v.Line)
+		}
+	} else {
+		errs = append(errs, ValidationError{Line: node.Line, Column: node.Column, Message: "job_name is required"})
+	}
+
+	// steps are checked one by one to report all of them
+	header := *node
+	header.Content = nil
+	var steps *yaml.Node
+	for j := 0; j+1 < len(node.Content); j += 2 {
+		if node.Content[j].Value == "steps" {
+			steps = node.Content[j+1]
+			continue
+		}
+		header.Content = append(header.Content, node.Content[j], node.Content[j+1])
+	}
+	var job JobConfig
+	if err := header.Decode(&job); err != nil {
+		verr := positioned(err, node)
+		// errors of JobConfig name the job themselves
+		if !strings.HasPrefix(verr.Message, "job ") {
+			verr = prefixed(verr, "job "+name)
+		}
+		errs = append(errs, verr)
+	}
+	if steps == nil {
+		return errs
+	}
+	if steps.Kind != yaml.SequenceNode {
+		return append(errs, ValidationError{Line: steps.Line, Column: steps.Column, Message: fmt.Sprintf("job %s: steps must be a list", name)})
+	}
+	for j, step := range steps.Content {
+		var tc transformer.TransformerConfig
+		if err := step.Decode(&tc); err != nil {
+			errs = append(errs, prefixed(positioned(err, step), fmt.Sprintf("job %s step [%d]", name, j)))
+		}
+	}
+	return errs
+}
+
+// checkScripts reports run() calls of javascript steps with undefined transformers
+func checkScripts(node *yaml.Node, transformers map[string]string) []ValidationError {
+	var errs []ValidationError
+	if node == nil {
+		return nil
+	}
+	if node.Kind == yaml.MappingNode {
+		if t := mappingValue(node, "type"); t != nil && t.Value == "javascript" {
+			if script := mappingValue(node, "script"); script != nil {
+				for _, m := range scriptRun.FindAllStringSubmatch(script.Value, -1) {
+					if _, ok := transformers[m[1]]; !ok {
+						errs = append(errs, ValidationError{Line: script.Line, Column: script.Column, Message: fmt.Sprintf("script runs undefined transformer %q", m[1])})
+					}
+				}
+			}
+		}
+	}
+	for _, child := range node.Content {
+		errs = append(errs, checkScripts(child, transformers)...)
+	}
+	return errs
+}
+
+// positioned converts err to a ValidationError at the most precise position known, node is the fallback
+func positioned(err error, node *yaml.Node) ValidationError {
+	var fieldErr *transformer.FieldError
+	if errors.As(err, &fieldErr) {
+		return ValidationError{Line: fieldErr.Line, Column: fieldErr.Column, Message: fmt.Sprintf("unknown field %q", fieldErr.Field)}
+	}
+	msg := err.Error()
+	if m := linePrefix.FindStringSubmatch(msg); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		column, _ := strconv.Atoi(m[2])
+		return ValidationError{Line: line, Column: column, Message: strings.TrimSpace(msg[len(m[0]):])}
+	}
+	return ValidationError{Line: node.Line, Column: node.Column, Message: msg}
+}
+
+func prefixed(err ValidationError, prefix string) ValidationError {
+	err.Message = prefix + ": " + err.Message
+	return err
+}
+
+func mappingKey(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return &yaml.Node{}
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i]
+		}
+	}
+	return &yaml.Node{}
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
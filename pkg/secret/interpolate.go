@@ -0,0 +1,82 @@
+package secret
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// reference matches ${env:NAME}, ${env:NAME:-default}, ${file:/path} and their escapes $${env: and $${file:
+var reference = regexp.MustCompile(`\$\$\{(?:env|file):|\$\{(env|file):([^}]*)\}`)
+
+// Interpolate replaces references in scalar values of node with environment variables and file contents.
+// It returns the resolved values, which are secrets of the config, and an error for every reference that cannot be resolved.
+func Interpolate(node *yaml.Node) ([]string, []error) {
+	var resolved []string
+	errs := interpolate(node, &resolved)
+	return resolved, errs
+}
+
+func interpolate(node *yaml.Node, resolved *[]string) []error {
+	if node == nil {
+		return nil
+	}
+	var errs []error
+	if node.Kind == yaml.ScalarNode {
+		value, err := resolve(node.Value, resolved)
+		if err != nil {
+			return []error{fmt.Errorf("line %d, column %d: %w", node.Line, node.Column, err)}
+		}
+		if value != node.Value {
+			node.Value = value
+			if node.Style == 0 {
+				// let plain scalars resolve to numbers and booleans again
+				node.Tag = ""
+			}
+		}
+		return nil
+	}
+	for _, child := range node.Content {
+		errs = append(errs, interpolate(child, resolved)...)
+	}
+	return errs
+}
+
+func resolve(s string, resolved *[]string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var err error
+	result := reference.ReplaceAllStringFunc(s, func(match string) string {
+		if strings.HasPrefix(match, "$${") {
+			return match[1:]
+		}
+		groups := reference.FindStringSubmatch(match)
+		name, def, hasDefault := strings.Cut(groups[2], ":-")
+		var value string
+		switch groups[1] {
+		case "env":
+			value = os.Getenv(name)
+			if value == "" && !hasDefault {
+				if _, ok := os.LookupEnv(name); !ok && err == nil {
+					err = fmt.Errorf("environment variable %s is not set", name)
+				}
+			}
+		case "file":
+			data, readErr := os.ReadFile(name)
+			if readErr != nil && !hasDefault && err == nil {
+				err = fmt.Errorf("cannot read secret file: %w", readErr)
+			}
+			value = strings.TrimRight(string(data), "\r\n")
+		}
+		if value == "" && hasDefault {
+			return def
+		}
+		*resolved = append(*resolved, value)
+		return value
+	})
+	return result, err
+}
@@ -0,0 +1,51 @@
+package secret
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/vitrevance/api-exporter/pkg/transformer"
+	"gopkg.in/yaml.v3"
+)
+
+// Rule redacts matches of Pattern, Replacement may refer to groups of the pattern like $1
+type Rule struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// UnmarshalYAML accepts either a pattern or a mapping with pattern and replacement
+func (this *Rule) UnmarshalYAML(value *yaml.Node) error {
+	var rule struct {
+		Pattern     string  `yaml:"pattern"`
+		Replacement *string `yaml:"replacement"`
+	}
+	if value.Kind == yaml.ScalarNode {
+		rule.Pattern = value.Value
+	} else if err := transformer.DecodeConfig(value, &rule); err != nil {
+		return err
+	}
+	if rule.Pattern == "" {
+		return fmt.Errorf("line %d: redaction pattern is required", value.Line)
+	}
+	pattern, err := regexp.Compile(rule.Pattern)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid redaction pattern: %w", value.Line, err)
+	}
+	this.Pattern = pattern
+	this.Replacement = Placeholder
+	if rule.Replacement != nil {
+		this.Replacement = *rule.Replacement
+	}
+	return nil
+}
+
+// SetRules replaces the redaction rules applied after registered secrets and the secrets of the config in use.
+// Secrets of the previous config are no longer redacted unless they were passed to Register.
+func SetRules(r []Rule, secrets []string) {
+	mu.Lock()
+	defer mu.Unlock()
+	rules = r
+	configValues = secrets
+	replacer = newReplacer(configValues)
+}
@@ -0,0 +1,155 @@
+package secret
+
+import (
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Placeholder replaces secret values in redacted output
+const Placeholder = "REDACTED"
+
+// minLength is the shortest value redacted, shorter ones would mangle unrelated output
+const minLength = 4
+
+// MaxValues bounds the values kept by Register, credentials that change every run or token refresh would grow them forever.
+// The value registered least recently is dropped first.
+const MaxValues = 1024
+
+// sensitiveName matches names of headers, query parameters and fields whose values are secrets
+var sensitiveName = regexp.MustCompile(`(?i)(authorization|cookie|token|secret|password|passwd|api[-_]?key|signature|session)`)
+
+// IsSensitiveName reports whether values named name, e.g. an Authorization header, are secrets
+func IsSensitiveName(name string) bool {
+	return sensitiveName.MatchString(name)
+}
+
+var (
+	mu sync.RWMutex
+	// values are registered with Register along with the order of their last registration,
+	// configValues are the secrets of the config in use
+	values       = make(map[string]uint64)
+	registered   uint64
+	configValues []string
+	replacer     = strings.NewReplacer()
+	rules        []Rule
+)
+
+// Register marks value as secret, so that Redact and Writer hide it
+func Register(value string) {
+	if len(value) < minLength {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	registered++
+	_, known := values[value]
+	values[value] = registered
+	if known {
+		return
+	}
+	if len(values) > MaxValues {
+		oldest := value
+		for v, order := range values {
+			if order < values[oldest] {
+				oldest = v
+			}
+		}
+		delete(values, oldest)
+	}
+	replacer = newReplacer(configValues)
+}
+
+// newReplacer replaces registered values and extra ones, mu must be held
+func newReplacer(extra []string) *strings.Replacer {
+	sorted := make([]string, 0, len(values)+len(extra))
+	for v := range values {
+		sorted = append(sorted, v)
+	}
+	for _, v := range extra {
+		if _, ok := values[v]; len(v) >= minLength && !ok {
+			sorted = append(sorted, v)
+		}
+	}
+	// longer values first, so that a secret containing another one is hidden whole
+	sort.Slice(sorted, func(i, j int) bool {
+		return len(sorted[i]) > len(sorted[j])
+	})
+	pairs := make([]string, 0, 2*len(sorted))
+	for _, v := range sorted {
+		pairs = append(pairs, v, Placeholder)
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+// Redact replaces every registered secret and every match of the redaction rules in s
+func Redact(s string) string {
+	mu.RLock()
+	r, rs := replacer, rules
+	mu.RUnlock()
+	s = r.Replace(s)
+	for _, rule := range rs {
+		s = rule.Pattern.ReplaceAllString(s, rule.Replacement)
+	}
+	return s
+}
+
+// RedactWith is Redact that also replaces values, e.g. the secrets of a config that is not in use yet
+func RedactWith(s string, values []string) string {
+	if len(values) > 0 {
+		mu.RLock()
+		r := newReplacer(values)
+		mu.RUnlock()
+		s = r.Replace(s)
+	}
+	return Redact(s)
+}
+
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (this *redactedError) Error() string {
+	return this.msg
+}
+
+func (this *redactedError) Unwrap() error {
+	return this.err
+}
+
+// Error returns err with secrets redacted from its message, errors.Is and errors.As still see err
+func Error(err error) error {
+	return ErrorWith(err, nil)
+}
+
+// ErrorWith is Error that also redacts values, e.g. the secrets of a config that is not in use yet
+func ErrorWith(err error, values []string) error {
+	if err == nil {
+		return nil
+	}
+	msg := RedactWith(err.Error(), values)
+	if msg == err.Error() {
+		return err
+	}
+	return &redactedError{msg: msg, err: err}
+}
+
+type writer struct {
+	out io.Writer
+}
+
+// Writer redacts secrets written to out, e.g. log.SetOutput(secret.Writer(os.Stderr)).
+// Secrets are only found within a single Write call.
+func Writer(out io.Writer) io.Writer {
+	return &writer{out: out}
+}
+
+func (this *writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(this.out, Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -2,6 +2,8 @@ package transformer
 
 import (
 	"fmt"
+	"sync"
+	"sync/atomic"
 
 	"gopkg.in/yaml.v3"
 )
@@ -14,7 +16,7 @@ type aliasTransformer struct {
 func NewAliasTransformerFactory(transformer string) TransformerFactory {
 	return TransformerFactoryFunc(func(value *yaml.Node) (Transformer, error) {
 		t := &aliasTransformer{}
-		err := value.Decode(t)
+		err := DecodeNode(value, t)
 		if err != nil {
 			return nil, err
 		}
@@ -39,3 +41,42 @@ func (this *aliasTransformer) Transform(ctx *TransformationContext) error {
 	}
 	return tr.Transform(ctx)
 }
+
+// Aliases are the transformer types defined by a config, each an alias of the transformer with its name
+type Aliases struct {
+	names map[string]bool
+}
+
+// Add makes name usable as a transformer type, it must not be the name of a registered type
+func (this *Aliases) Add(name string) error {
+	if transformerTypes[name] != nil {
+		return fmt.Errorf("transformer name %q conflicts with a built-in transformer type", name)
+	}
+	this.names[name] = true
+	return nil
+}
+
+var (
+	// decodeMu serializes config decodes, which share aliases and strict decoding
+	decodeMu sync.Mutex
+	aliases  atomic.Pointer[Aliases]
+)
+
+// WithAliases runs decode with aliases added during it usable as transformer types. Unlike registered types
+// they are gone once decode returns, so configs decoded one after another never see names of each other.
+func WithAliases(decode func(aliases *Aliases) error) error {
+	decodeMu.Lock()
+	defer decodeMu.Unlock()
+	scope := &Aliases{names: make(map[string]bool)}
+	aliases.Store(scope)
+	defer aliases.Store(nil)
+	return decode(scope)
+}
+
+// aliasFactory returns the factory of name if it is an alias of the config being decoded
+func aliasFactory(name string) TransformerFactory {
+	if scope := aliases.Load(); scope != nil && scope.names[name] {
+		return NewAliasTransformerFactory(name)
+	}
+	return nil
+}
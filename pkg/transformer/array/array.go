@@ -1,7 +1,9 @@
 package array
 
 import (
+	"errors"
 	"fmt"
+	"io"
 
 	"github.com/vitrevance/api-exporter/pkg/transformer"
 	"gopkg.in/yaml.v3"
@@ -14,7 +16,7 @@ type itemsTransformer struct {
 func init() {
 	transformer.RegisterTransformerFactory("array", transformer.TransformerFactoryFunc(func(value *yaml.Node) (transformer.Transformer, error) {
 		t := &itemsTransformer{}
-		err := value.Decode(t)
+		err := transformer.DecodeNode(value, t)
 		if err != nil {
 			return nil, err
 		}
@@ -23,8 +25,21 @@ func init() {
 }
 
 func (this *itemsTransformer) Transform(ctx *transformer.TransformationContext) error {
-	src, ok := ctx.Object.([]any)
-	if !ok {
+	var next func() (any, error)
+	switch src := ctx.Object.(type) {
+	case []any:
+		i := 0
+		next = func() (any, error) {
+			if i >= len(src) {
+				return nil, io.EOF
+			}
+			i++
+			return src[i-1], nil
+		}
+	case transformer.Stream:
+		defer src.Close()
+		next = src.Next
+	default:
 		return fmt.Errorf("invalid array object")
 	}
 
@@ -35,13 +50,24 @@ func (this *itemsTransformer) Transform(ctx *transformer.TransformationContext)
 		result = make([]any, 0)
 	}
 
-	for _, elem := range src {
+	for {
+		if err := ctx.Ctx().Err(); err != nil {
+			return err
+		}
+		elem, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
 		mapperCtx := &transformer.TransformationContext{
+			Context:      ctx.Context,
 			Object:       elem,
 			Result:       make(map[string]any),
 			Transformers: ctx.Transformers,
 		}
-		err := this.Map.Transformer.Transform(mapperCtx)
+		err = this.Map.Transformer.Transform(mapperCtx)
 		if err != nil {
 			return err
 		}
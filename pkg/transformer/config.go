@@ -1,17 +1,28 @@
 package transformer
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 type TransformationContext struct {
+	Context      context.Context
 	Object       any
 	Result       any
 	Transformers map[string]Transformer
 }
 
+// Ctx returns the context governing the transformation, context.Background if none is set
+func (this *TransformationContext) Ctx() context.Context {
+	if this.Context == nil {
+		return context.Background()
+	}
+	return this.Context
+}
+
 type Transformer interface {
 	Transform(*TransformationContext) error
 }
@@ -43,13 +54,15 @@ func UnregisterTransformerFactory(name string) {
 type TransformerConfig struct {
 	Type        string
 	KeepContext bool
+	Timeout     time.Duration
 	Transformer Transformer
 }
 
 func (this *TransformerConfig) UnmarshalYAML(value *yaml.Node) error {
 	type typeHeader struct {
-		Type        string `yaml:"type"`
-		KeepContext bool   `yaml:"keep_ctx"`
+		Type        string        `yaml:"type"`
+		KeepContext bool          `yaml:"keep_ctx"`
+		Timeout     time.Duration `yaml:"timeout"`
 	}
 	t := &typeHeader{}
 	err := value.Decode(t)
@@ -57,20 +70,60 @@ func (this *TransformerConfig) UnmarshalYAML(value *yaml.Node) error {
 		return err
 	}
 	if t.Type == "" {
-		return fmt.Errorf("transformer type is required")
+		return fmt.Errorf("line %d: transformer type is required", value.Line)
 	}
 	this.Type = t.Type
 	this.KeepContext = t.KeepContext
+	this.Timeout = t.Timeout
+	if this.Timeout < 0 {
+		return fmt.Errorf("timeout of %s transformer must not be negative", this.Type)
+	}
 	factory := transformerTypes[this.Type]
-
 	if factory == nil {
-		return fmt.Errorf("unknown transformer type %s", this.Type)
+		factory = aliasFactory(this.Type)
+	}
+	if factory == nil {
+		return fmt.Errorf("line %d: unknown transformer type %s", value.Line, this.Type)
 	}
 
 	tr, err := factory.UnmarshalYAML(value)
 	if err != nil {
 		return err
 	}
+	if this.Timeout > 0 {
+		tr = &timeoutTransformer{
+			timeout:     this.Timeout,
+			transformer: tr,
+		}
+	}
 	this.Transformer = tr
 	return nil
 }
+
+// timeoutTransformer limits the wrapped transformer to a fixed duration
+type timeoutTransformer struct {
+	timeout     time.Duration
+	transformer Transformer
+}
+
+func (this *timeoutTransformer) Transform(ctx *TransformationContext) error {
+	parent := ctx.Context
+	stepCtx, cancel := context.WithTimeout(ctx.Ctx(), this.timeout)
+	// streams are read by later steps, so the step context ends once they are closed or the timeout passes
+	streaming := false
+	defer func() {
+		if !streaming {
+			cancel()
+		}
+	}()
+	ctx.Context = stepCtx
+	err := this.transformer.Transform(ctx)
+	ctx.Context = parent
+	if err == nil {
+		ctx.Result, streaming = releaseOnClose(ctx.Result, cancel)
+	}
+	if err != nil && stepCtx.Err() == context.DeadlineExceeded && ctx.Ctx().Err() == nil {
+		return fmt.Errorf("timed out after %v: %w", this.timeout, err)
+	}
+	return err
+}
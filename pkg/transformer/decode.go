@@ -0,0 +1,165 @@
+package transformer
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// headerFields are keys of the step header allowed in every transformer config
+var headerFields = map[string]bool{
+	"type":     true,
+	"keep_ctx": true,
+	"timeout":  true,
+}
+
+// strictDecoding is on by default, configs opt out with a top-level `strict: false`
+var strictDecoding = true
+
+// SetStrictDecoding makes DecodeNode reject unknown fields
+func SetStrictDecoding(strict bool) {
+	strictDecoding = strict
+}
+
+// StrictDecoding reports whether unknown fields are rejected
+func StrictDecoding() bool {
+	return strictDecoding
+}
+
+// FieldError reports an unknown field of a config
+type FieldError struct {
+	Field  string
+	Line   int
+	Column int
+}
+
+func (this *FieldError) Error() string {
+	return fmt.Sprintf("line %d, column %d: unknown field %q", this.Line, this.Column, this.Field)
+}
+
+// DecodeNode decodes value into out like value.Decode, transformer factories use it to decode their configs.
+// With strict decoding, fields of value unknown to out and the step header are reported as *FieldError.
+func DecodeNode(value *yaml.Node, out any) error {
+	if strictDecoding {
+		if err := checkFields(value, reflect.TypeOf(out), headerFields); err != nil {
+			return err
+		}
+	}
+	return value.Decode(out)
+}
+
+// DecodeConfig is DecodeNode for configs other than transformer steps, which have no step header
+func DecodeConfig(value *yaml.Node, out any) error {
+	if strictDecoding {
+		if err := checkFields(value, reflect.TypeOf(out), nil); err != nil {
+			return err
+		}
+	}
+	return value.Decode(out)
+}
+
+var (
+	unmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+	nodeType        = reflect.TypeOf(yaml.Node{})
+)
+
+// checkFields walks value along the struct type t and reports the first mapping key without a matching field.
+// Types with their own UnmarshalYAML are responsible for their fields.
+func checkFields(value *yaml.Node, t reflect.Type, allowed map[string]bool) error {
+	if value == nil || t == nil {
+		return nil
+	}
+	if value.Kind == yaml.DocumentNode && len(value.Content) > 0 {
+		value = value.Content[0]
+	}
+	if value.Kind == yaml.AliasNode {
+		value = value.Alias
+	}
+	if t == nodeType || reflect.PointerTo(t).Implements(unmarshalerType) || t.Implements(unmarshalerType) {
+		return nil
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+		if t == nodeType || reflect.PointerTo(t).Implements(unmarshalerType) {
+			return nil
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if value.Kind != yaml.MappingNode {
+			return nil
+		}
+		fields := make(map[string]reflect.Type)
+		collectFields(t, fields)
+		for i := 0; i+1 < len(value.Content); i += 2 {
+			key, val := value.Content[i], value.Content[i+1]
+			if key.Value == "<<" {
+				if err := checkFields(val, t, allowed); err != nil {
+					return err
+				}
+				continue
+			}
+			ft, ok := fields[key.Value]
+			if !ok {
+				if allowed[key.Value] {
+					continue
+				}
+				return &FieldError{Field: key.Value, Line: key.Line, Column: key.Column}
+			}
+			if err := checkFields(val, ft, nil); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if value.Kind != yaml.SequenceNode {
+			return nil
+		}
+		for _, item := range value.Content {
+			if err := checkFields(item, t.Elem(), nil); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if value.Kind != yaml.MappingNode {
+			return nil
+		}
+		for i := 1; i < len(value.Content); i += 2 {
+			if err := checkFields(value.Content[i], t.Elem(), nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// collectFields maps yaml keys of struct t to field types the way yaml.v3 does
+func collectFields(t reflect.Type, fields map[string]reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		tag := f.Tag.Get("yaml")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if strings.Contains(opts, "inline") {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				collectFields(ft, fields)
+			}
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f.Type
+	}
+}
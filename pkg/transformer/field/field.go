@@ -16,7 +16,7 @@ type jsonTransformer struct {
 func init() {
 	transformer.RegisterTransformerFactory("field", transformer.TransformerFactoryFunc(func(value *yaml.Node) (transformer.Transformer, error) {
 		t := &jsonTransformer{}
-		err := value.Decode(t)
+		err := transformer.DecodeNode(value, t)
 		if err != nil {
 			return nil, err
 		}
@@ -51,6 +51,7 @@ func (this *jsonTransformer) Transform(ctx *transformer.TransformationContext) e
 
 	if this.Map != nil {
 		mapperCtx := &transformer.TransformationContext{
+			Context:      ctx.Context,
 			Object:       src,
 			Result:       target,
 			Transformers: ctx.Transformers,
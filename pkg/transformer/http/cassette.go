@@ -0,0 +1,306 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/vitrevance/api-exporter/pkg/secret"
+)
+
+const (
+	CassetteRecord      = "record"
+	CassetteReplay      = "replay"
+	CassettePassthrough = "passthrough"
+)
+
+// cassette is a transport that records interactions into files of dir or replays them from there
+type cassette struct {
+	dir  string
+	mode string
+	next http.RoundTripper
+}
+
+var activeCassette *cassette
+
+// SetCassette makes every http step record interactions into dir or replay them from there depending on mode.
+// It must be called before any client is created.
+func SetCassette(dir, mode string) error {
+	switch mode {
+	case CassettePassthrough:
+	case CassetteRecord:
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("cannot create cassette dir: %w", err)
+		}
+	case CassetteReplay:
+		if _, err := os.Stat(dir); err != nil {
+			return fmt.Errorf("cannot open cassette dir: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown cassette mode %q, expecting record, replay or passthrough", mode)
+	}
+	if mode == CassettePassthrough {
+		activeCassette = nil
+	} else {
+		activeCassette = &cassette{dir: dir, mode: mode}
+	}
+
+	// cached clients wrap the previous cassette
+	clientsMu.Lock()
+	clients.clear()
+	clientsMu.Unlock()
+	return nil
+}
+
+type responseLimitKey struct{}
+
+// withResponseLimit makes a cassette recording responses to requests of ctx fail on bodies larger than limit
+func withResponseLimit(ctx context.Context, limit int64) context.Context {
+	return context.WithValue(ctx, responseLimitKey{}, limit)
+}
+
+func responseLimit(ctx context.Context) int64 {
+	limit, _ := ctx.Value(responseLimitKey{}).(int64)
+	return limit
+}
+
+func (this *cassette) wrap(next http.RoundTripper) http.RoundTripper {
+	return &cassette{dir: this.dir, mode: this.mode, next: next}
+}
+
+type cassetteRequest struct {
+	Method  string              `json:"method"`
+	URL     string              `json:"url"`
+	Headers map[string][]string `json:"headers,omitempty"`
+	Body    string              `json:"body,omitempty"`
+	Body64  string              `json:"body_base64,omitempty"`
+}
+
+type cassetteResponse struct {
+	StatusCode int                 `json:"status_code"`
+	Headers    map[string][]string `json:"headers,omitempty"`
+	Body       string              `json:"body,omitempty"`
+	Body64     string              `json:"body_base64,omitempty"`
+}
+
+type interaction struct {
+	Request  cassetteRequest  `json:"request"`
+	Response cassetteResponse `json:"response"`
+}
+
+func redactHeaders(header http.Header) map[string][]string {
+	if len(header) == 0 {
+		return nil
+	}
+	result := make(map[string][]string, len(header))
+	for k, v := range header {
+		if secret.IsSensitiveName(k) {
+			result[k] = []string{secret.Placeholder}
+		} else {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+func redactURL(u *url.URL) string {
+	clone := *u
+	clone.User = nil
+	q := clone.Query()
+	for k := range q {
+		if secret.IsSensitiveName(k) {
+			q[k] = []string{secret.Placeholder}
+		}
+	}
+	clone.RawQuery = q.Encode()
+	return clone.String()
+}
+
+// redactFields masks sensitive fields of json and form bodies, other bodies are returned as is
+func redactFields(header http.Header, body []byte) []byte {
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return body
+		}
+		masked := false
+		for k := range form {
+			if secret.IsSensitiveName(k) {
+				form[k] = []string{secret.Placeholder}
+				masked = true
+			}
+		}
+		if masked {
+			return []byte(form.Encode())
+		}
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		var value any
+		if err := decoder.Decode(&value); err != nil {
+			return body
+		}
+		if redactJSON(value) {
+			if data, err := json.Marshal(value); err == nil {
+				return data
+			}
+		}
+	}
+	return body
+}
+
+// redactJSON masks values of sensitive keys in place and reports whether any was masked
+func redactJSON(value any) bool {
+	masked := false
+	switch v := value.(type) {
+	case map[string]any:
+		for k, item := range v {
+			if secret.IsSensitiveName(k) {
+				v[k] = secret.Placeholder
+				masked = true
+			} else if redactJSON(item) {
+				masked = true
+			}
+		}
+	case []any:
+		for _, item := range v {
+			if redactJSON(item) {
+				masked = true
+			}
+		}
+	}
+	return masked
+}
+
+// redactBody masks sensitive fields and registered secrets of a recorded body
+func redactBody(header http.Header, body []byte) []byte {
+	body = redactFields(header, body)
+	if !utf8.Valid(body) {
+		return body
+	}
+	return []byte(secret.Redact(string(body)))
+}
+
+func encodeCassetteBody(data []byte) (string, string) {
+	if utf8.Valid(data) {
+		return string(data), ""
+	}
+	return "", base64.StdEncoding.EncodeToString(data)
+}
+
+func decodeCassetteBody(body, body64 string) ([]byte, error) {
+	if body64 != "" {
+		return base64.StdEncoding.DecodeString(body64)
+	}
+	return []byte(body), nil
+}
+
+// path returns the file of the interaction keyed by method, redacted URL and hash of the body with sensitive fields masked
+func (this *cassette) path(method, redactedURL string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	key := sha256.Sum256([]byte(method + " " + redactedURL + " " + hex.EncodeToString(bodyHash[:])))
+	host := "local"
+	if u, err := url.Parse(redactedURL); err == nil && u.Host != "" {
+		host = strings.NewReplacer(":", "_", "/", "_").Replace(u.Host)
+	}
+	return filepath.Join(this.dir, fmt.Sprintf("%s_%s_%s.json", strings.ToLower(method), host, hex.EncodeToString(key[:8])))
+}
+
+func (this *cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	redactedURL := redactURL(req.URL)
+	// keyed by masked fields, so replays match without the recorded credentials
+	path := this.path(req.Method, redactedURL, redactFields(req.Header, body))
+
+	if this.mode == CassetteReplay {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("cassette has no recorded interaction for %s %s (%s)", req.Method, redactedURL, path)
+		}
+		if err != nil {
+			return nil, err
+		}
+		var rec interaction
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return nil, fmt.Errorf("invalid cassette file %s: %w", path, err)
+		}
+		respBody, err := decodeCassetteBody(rec.Response.Body, rec.Response.Body64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cassette file %s: %w", path, err)
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", rec.Response.StatusCode, http.StatusText(rec.Response.StatusCode)),
+			StatusCode:    rec.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header(rec.Response.Headers),
+			Body:          io.NopCloser(bytes.NewReader(respBody)),
+			ContentLength: int64(len(respBody)),
+			Request:       req,
+		}, nil
+	}
+
+	resp, err := this.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	// the response is recorded whole, so the limit of the step applies before the body is read
+	respBody, err := io.ReadAll(limitBody(resp.Body, responseLimit(req.Context())))
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	rec := interaction{
+		Request: cassetteRequest{
+			Method:  req.Method,
+			URL:     redactedURL,
+			Headers: redactHeaders(req.Header),
+		},
+		Response: cassetteResponse{
+			StatusCode: resp.StatusCode,
+			Headers:    redactHeaders(resp.Header),
+		},
+	}
+	rec.Request.Body, rec.Request.Body64 = encodeCassetteBody(redactBody(req.Header, body))
+	rec.Response.Body, rec.Response.Body64 = encodeCassetteBody(redactBody(resp.Header, respBody))
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return nil, fmt.Errorf("cannot record interaction: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, fmt.Errorf("cannot record interaction: %w", err)
+	}
+	return resp, nil
+}
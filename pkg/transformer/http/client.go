@@ -0,0 +1,95 @@
+package http
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+)
+
+// clientKey holds every setting that affects *http.Client and its transport
+type clientKey struct {
+	timeoutMillis         int
+	idleConnTimeoutMillis int
+	maxIdleConns          int
+	maxIdleConnsPerHost   int
+	tlsInsecureSkipVerify bool
+	proxyURL              string
+	tlsCAFile             string
+	tlsCA                 string
+	tlsCertFile           string
+	tlsKeyFile            string
+	tlsServerName         string
+	tlsMinVersion         string
+	followRedirects       bool
+}
+
+// maxClients bounds the shared clients, settings rendered from templates may differ on every run
+const maxClients = 64
+
+var (
+	clientsMu sync.Mutex
+	clients   = newLRU[clientKey](maxClients, func(client *http.Client) {
+		client.CloseIdleConnections()
+	})
+)
+
+func (c *HttpTargetConfig) clientKey() clientKey {
+	return clientKey{
+		timeoutMillis:         c.TimeoutMillis,
+		idleConnTimeoutMillis: c.IdleConnTimeoutMillis,
+		maxIdleConns:          c.MaxIdleConns,
+		maxIdleConnsPerHost:   c.MaxIdleConnsPerHost,
+		tlsInsecureSkipVerify: c.TLSInsecureSkipVerify,
+		proxyURL:              c.ProxyURL,
+		tlsCAFile:             c.TLSCAFile,
+		tlsCA:                 c.TLSCA,
+		tlsCertFile:           c.TLSCertFile,
+		tlsKeyFile:            c.TLSKeyFile,
+		tlsServerName:         c.TLSServerName,
+		tlsMinVersion:         c.TLSMinVersion,
+		followRedirects:       c.FollowRedirects == nil || *c.FollowRedirects,
+	}
+}
+
+// HttpClient returns a client shared by all configs with the same transport settings,
+// so that connections are pooled across calls, steps and jobs
+func (c *HttpTargetConfig) HttpClient() (*http.Client, error) {
+	key := c.clientKey()
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	if client, ok := clients.get(key); ok {
+		return client, nil
+	}
+	client, err := c.CreateHttpClient()
+	if err != nil {
+		return nil, err
+	}
+	clients.add(key, client)
+	return client, nil
+}
+
+// Clone returns a deep copy of the config, so that per-call overrides never leak into the base config
+func (c *HttpTargetConfig) Clone() *HttpTargetConfig {
+	clone := *c
+	clone.Headers = maps.Clone(c.Headers)
+	clone.QueryParams = maps.Clone(c.QueryParams)
+	if c.FollowRedirects != nil {
+		followRedirects := *c.FollowRedirects
+		clone.FollowRedirects = &followRedirects
+	}
+	clone.ExpectStatus = slices.Clone(c.ExpectStatus)
+	clone.Retry.StatusCodes = slices.Clone(c.Retry.StatusCodes)
+	clone.Retry.Methods = slices.Clone(c.Retry.Methods)
+	if c.Pagination.Start != nil {
+		start := *c.Pagination.Start
+		clone.Pagination.Start = &start
+	}
+	if c.OAuth2 != nil {
+		oauth2 := *c.OAuth2
+		oauth2.Scopes = slices.Clone(c.OAuth2.Scopes)
+		oauth2.EndpointParams = maps.Clone(c.OAuth2.EndpointParams)
+		clone.OAuth2 = &oauth2
+	}
+	return &clone
+}
@@ -0,0 +1,99 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+const (
+	EncodingRaw  = "raw"
+	EncodingJSON = "json"
+	EncodingForm = "form-urlencoded"
+
+	DecodingAuto  = "auto"
+	DecodingJSON  = "json"
+	DecodingText  = "text"
+	DecodingBytes = "bytes"
+)
+
+func validateEncodings(requestEncoding, responseDecoding string) error {
+	if !slices.Contains([]string{"", EncodingRaw, EncodingJSON, EncodingForm}, requestEncoding) {
+		return fmt.Errorf("unknown request_encoding %q, expecting raw, json or form-urlencoded", requestEncoding)
+	}
+	if !slices.Contains([]string{"", DecodingAuto, DecodingJSON, DecodingText, DecodingBytes}, responseDecoding) {
+		return fmt.Errorf("unknown response_decoding %q, expecting auto, json, text or bytes", responseDecoding)
+	}
+	return nil
+}
+
+// encodeBody serializes body according to encoding and returns the default content type for it.
+// Strings and bytes are always sent as-is.
+func encodeBody(body any, encoding string) ([]byte, string, error) {
+	switch v := body.(type) {
+	case nil:
+		return nil, "", nil
+	case string:
+		return []byte(v), "", nil
+	case []byte:
+		return v, "", nil
+	}
+	switch encoding {
+	case EncodingJSON:
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, "", fmt.Errorf("cannot encode body as JSON: %w", err)
+		}
+		return data, "application/json", nil
+	case EncodingForm:
+		m, ok := body.(map[string]any)
+		if !ok {
+			return nil, "", fmt.Errorf("form-urlencoded body must be an object, got %T", body)
+		}
+		form := url.Values{}
+		for k, v := range m {
+			if arr, ok := v.([]any); ok {
+				for _, item := range arr {
+					form.Add(k, fmt.Sprint(item))
+				}
+			} else {
+				form.Set(k, fmt.Sprint(v))
+			}
+		}
+		return []byte(form.Encode()), "application/x-www-form-urlencoded", nil
+	default:
+		return nil, "", fmt.Errorf("body of type %T requires request_encoding json or form-urlencoded", body)
+	}
+}
+
+// decodeBody converts response bytes according to decoding, auto picks it by contentType
+func decodeBody(data []byte, contentType, decoding string) (any, error) {
+	if decoding == DecodingAuto {
+		decoding = DecodingBytes
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		switch {
+		case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+			decoding = DecodingJSON
+		case strings.HasPrefix(mediaType, "text/") || mediaType == "application/xml" || strings.HasSuffix(mediaType, "+xml"):
+			decoding = DecodingText
+		}
+	}
+	switch decoding {
+	case DecodingJSON:
+		if len(data) == 0 {
+			return nil, nil
+		}
+		var obj any
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return nil, fmt.Errorf("cannot decode JSON response: %w", err)
+		}
+		return obj, nil
+	case DecodingText:
+		return string(data), nil
+	default:
+		return data, nil
+	}
+}
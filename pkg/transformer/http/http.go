@@ -2,16 +2,18 @@ package http
 
 import (
 	"bytes"
-	"crypto/tls"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
 	"net/url"
 	"reflect"
 	"strconv"
 	"time"
 
+	"github.com/vitrevance/api-exporter/pkg/secret"
 	"github.com/vitrevance/api-exporter/pkg/transformer"
 	"gopkg.in/yaml.v3"
 )
@@ -29,8 +31,15 @@ type HttpTargetConfig struct {
 	// URL query parameters
 	QueryParams map[string]string `yaml:"query_params"`
 
-	// Request body as bytes
-	Body string `yaml:"body"`
+	// Request body, a string is sent as-is, other values are encoded with RequestEncoding
+	Body any `yaml:"body"`
+
+	// raw (default), json or form-urlencoded
+	RequestEncoding string `yaml:"request_encoding"`
+
+	// Decoding of the response body: auto by Content-Type, json, text or bytes.
+	// When set the result holds the decoded body and raw_body with the bytes, otherwise body holds the bytes.
+	ResponseDecoding string `yaml:"response_decoding"`
 
 	// Basic auth credentials
 	BasicAuthUsername string `yaml:"basic_auth_username"`
@@ -44,8 +53,36 @@ type HttpTargetConfig struct {
 	TLSInsecureSkipVerify bool   `yaml:"tls_insecure_skip_verify"`
 	ProxyURL              string `yaml:"proxy_url"`
 
+	// TLS options, files are re-read when they change on disk
+	TLSCAFile     string `yaml:"tls_ca_file"`
+	TLSCA         string `yaml:"tls_ca"` // inline PEM
+	TLSCertFile   string `yaml:"tls_cert_file"`
+	TLSKeyFile    string `yaml:"tls_key_file"`
+	TLSServerName string `yaml:"tls_server_name"`
+	TLSMinVersion string `yaml:"tls_min_version"`
+
 	// Follow redirects (default true)
 	FollowRedirects *bool `yaml:"follow_redirects"`
+
+	// Maximum size of the response body, unlimited if 0
+	MaxResponseBytes int64 `yaml:"max_response_bytes"`
+
+	// Streaming of the response body: json (elements of an array at StreamPath) or ndjson (a record per line).
+	// The result body is then a stream of records to be consumed by an array step.
+	Stream     string `yaml:"stream"`
+	StreamPath string `yaml:"stream_path"`
+
+	// Accepted response status codes, e.g. [200, 2xx, 200-204]; any status is accepted if empty
+	ExpectStatus []string `yaml:"expect_status"`
+
+	// Retry policy for failed requests
+	Retry RetryConfig `yaml:"retry"`
+
+	// Pagination policy, the result is an array of pages when enabled
+	Pagination PaginationConfig `yaml:"pagination"`
+
+	// OAuth2 authentication, tokens are cached until expiry across steps and jobs
+	OAuth2 *OAuth2Config `yaml:"oauth2"`
 }
 
 func (c *HttpTargetConfig) MergeMap(cfg map[string]any) error {
@@ -94,12 +131,18 @@ func (c *HttpTargetConfig) MergeMap(cfg map[string]any) error {
 				return fmt.Errorf("invalid type for query_params, expected map[string]any")
 			}
 		case "body":
-			// Accept string or []byte for simplicity
-			switch v := value.(type) {
-			case string:
-				c.Body = v
-			default:
-				return fmt.Errorf("invalid type for body, expected string or []byte")
+			c.Body = value
+		case "request_encoding":
+			if v, ok := value.(string); ok {
+				c.RequestEncoding = v
+			} else {
+				return fmt.Errorf("invalid type for request_encoding, expected string")
+			}
+		case "response_decoding":
+			if v, ok := value.(string); ok {
+				c.ResponseDecoding = v
+			} else {
+				return fmt.Errorf("invalid type for response_decoding, expected string")
 			}
 		case "basic_auth_username":
 			if v, ok := value.(string); ok {
@@ -149,12 +192,83 @@ func (c *HttpTargetConfig) MergeMap(cfg map[string]any) error {
 			} else {
 				return fmt.Errorf("invalid type for proxy_url, expected string")
 			}
+		case "tls_ca_file", "tls_ca", "tls_cert_file", "tls_key_file", "tls_server_name", "tls_min_version":
+			v, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("invalid type for %s, expected string", key)
+			}
+			switch key {
+			case "tls_ca_file":
+				c.TLSCAFile = v
+			case "tls_ca":
+				c.TLSCA = v
+			case "tls_cert_file":
+				c.TLSCertFile = v
+			case "tls_key_file":
+				c.TLSKeyFile = v
+			case "tls_server_name":
+				c.TLSServerName = v
+			case "tls_min_version":
+				c.TLSMinVersion = v
+			}
 		case "follow_redirects":
 			if bv, ok := value.(bool); ok {
 				c.FollowRedirects = &bv
 			} else {
 				return fmt.Errorf("invalid type for follow_redirects, expected bool")
 			}
+		case "max_response_bytes":
+			if iv, err := toInt(value); err == nil {
+				c.MaxResponseBytes = int64(iv)
+			} else {
+				return fmt.Errorf("invalid type for max_response_bytes: %v", err)
+			}
+		case "stream", "stream_path":
+			v, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("invalid type for %s, expected string", key)
+			}
+			if key == "stream" {
+				c.Stream = v
+			} else {
+				c.StreamPath = v
+			}
+		case "expect_status":
+			arr, ok := value.([]any)
+			if !ok {
+				return fmt.Errorf("invalid type for expect_status, expected array")
+			}
+			c.ExpectStatus = make([]string, 0, len(arr))
+			for _, v := range arr {
+				c.ExpectStatus = append(c.ExpectStatus, fmt.Sprint(v))
+			}
+		case "retry":
+			if m, ok := value.(map[string]any); ok {
+				if err := c.Retry.MergeMap(m); err != nil {
+					return err
+				}
+			} else {
+				return fmt.Errorf("invalid type for retry, expected map[string]any")
+			}
+		case "pagination":
+			if m, ok := value.(map[string]any); ok {
+				if err := c.Pagination.MergeMap(m); err != nil {
+					return err
+				}
+			} else {
+				return fmt.Errorf("invalid type for pagination, expected map[string]any")
+			}
+		case "oauth2":
+			if m, ok := value.(map[string]any); ok {
+				if c.OAuth2 == nil {
+					c.OAuth2 = &OAuth2Config{}
+				}
+				if err := c.OAuth2.MergeMap(m); err != nil {
+					return err
+				}
+			} else {
+				return fmt.Errorf("invalid type for oauth2, expected map[string]any")
+			}
 		}
 	}
 	return nil
@@ -189,21 +303,57 @@ func NewHttpTargetConfig() *HttpTargetConfig {
 		MaxIdleConnsPerHost:   10,
 		TLSInsecureSkipVerify: false,
 		FollowRedirects:       &trueVal, // default to follow redirects
+		Retry:                 NewRetryConfig(),
+		Pagination:            NewPaginationConfig(),
 	}
 }
 
-// CreateHttpClient builds *http.Client from config
+func (c *HttpTargetConfig) validate() error {
+	if err := validateEncodings(c.RequestEncoding, c.ResponseDecoding); err != nil {
+		return err
+	}
+	if _, err := parseExpectStatus(c.ExpectStatus); err != nil {
+		return err
+	}
+	if c.MaxResponseBytes < 0 {
+		return errors.New("max_response_bytes must not be negative")
+	}
+	switch c.Stream {
+	case "", StreamJSON, StreamNDJSON:
+	default:
+		return fmt.Errorf("unknown stream %q, expecting json or ndjson", c.Stream)
+	}
+	if c.Stream != "" && (c.Pagination.Strategy != "" || c.ResponseDecoding != "") {
+		return errors.New("stream cannot be combined with pagination or response_decoding")
+	}
+	if err := c.Retry.validate(); err != nil {
+		return err
+	}
+	if c.OAuth2 != nil {
+		if err := c.OAuth2.validate(); err != nil {
+			return err
+		}
+	}
+	return c.Pagination.validate()
+}
+
+// CreateHttpClient builds a new *http.Client from config, see HttpClient for a shared one
 func (c *HttpTargetConfig) CreateHttpClient() (*http.Client, error) {
 	timeout := time.Duration(c.TimeoutMillis) * time.Millisecond
-	tlsSkip := c.TLSInsecureSkipVerify
+	tlsConfig, err := c.createTLSConfig()
+	if err != nil {
+		return nil, err
+	}
 
 	transport := &http.Transport{
 		IdleConnTimeout:     time.Duration(c.IdleConnTimeoutMillis) * time.Millisecond,
 		MaxIdleConns:        c.MaxIdleConns,
 		MaxIdleConnsPerHost: c.MaxIdleConnsPerHost,
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: tlsSkip,
-		},
+		TLSClientConfig:     tlsConfig,
+	}
+	if tlsConfig.VerifyConnection != nil {
+		// connections through a proxy are verified with the SNI only
+		transport.DialTLSContext = dialTLS(tlsConfig)
 	}
 	if c.ProxyURL != "" {
 		proxyURL, err := url.Parse(c.ProxyURL)
@@ -217,6 +367,9 @@ func (c *HttpTargetConfig) CreateHttpClient() (*http.Client, error) {
 		Timeout:   timeout,
 		Transport: transport,
 	}
+	if activeCassette != nil {
+		client.Transport = activeCassette.wrap(transport)
+	}
 
 	if c.FollowRedirects != nil && !*c.FollowRedirects {
 		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
@@ -229,8 +382,8 @@ func (c *HttpTargetConfig) CreateHttpClient() (*http.Client, error) {
 	return client, nil
 }
 
-// CreateHttpRequest builds *http.Request with configured properties
-func (c *HttpTargetConfig) CreateHttpRequest() (*http.Request, error) {
+// CreateHttpRequest builds *http.Request with configured properties bound to ctx
+func (c *HttpTargetConfig) CreateHttpRequest(ctx context.Context) (*http.Request, error) {
 	if c.URL == "" {
 		return nil, errors.New("url must be specified")
 	}
@@ -249,16 +402,23 @@ func (c *HttpTargetConfig) CreateHttpRequest() (*http.Request, error) {
 	}
 	reqURL.RawQuery = q.Encode()
 
+	body, contentType, err := encodeBody(c.Body, c.RequestEncoding)
+	if err != nil {
+		return nil, err
+	}
 	var bodyReader io.Reader
-	if len(c.Body) > 0 {
-		bodyReader = bytes.NewReader([]byte(c.Body))
+	if len(body) > 0 {
+		bodyReader = bytes.NewReader(body)
 	}
 
-	req, err := http.NewRequest(method, reqURL.String(), bodyReader)
+	req, err := http.NewRequestWithContext(ctx, method, reqURL.String(), bodyReader)
 	if err != nil {
 		return nil, err
 	}
 
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
 	for key, val := range c.Headers {
 		req.Header.Set(key, val)
 	}
@@ -273,7 +433,19 @@ func (c *HttpTargetConfig) CreateHttpRequest() (*http.Request, error) {
 func init() {
 	transformer.RegisterTransformerFactory("http", transformer.TransformerFactoryFunc(func(value *yaml.Node) (transformer.Transformer, error) {
 		t := NewHttpTargetConfig()
-		err := value.Decode(t)
+		err := transformer.DecodeNode(value, t)
+		if err != nil {
+			return nil, err
+		}
+		err = t.validate()
+		if err != nil {
+			return nil, err
+		}
+		err = t.checkTemplates()
+		if err != nil {
+			return nil, err
+		}
+		_, err = t.createTLSConfig()
 		return &httpTransformer{
 			Config: t,
 		}, err
@@ -284,28 +456,45 @@ type httpTransformer struct {
 	Config *HttpTargetConfig
 }
 
-func (this *httpTransformer) Transform(ctx *transformer.TransformationContext) error {
-	mp, ok := ctx.Object.(map[string]any)
-	if !ok {
-		return fmt.Errorf("invalid source")
+func (this *httpTransformer) Transform(ctx *transformer.TransformationContext) (err error) {
+	// errors may quote requests and responses carrying credentials
+	defer func() {
+		err = secret.Error(err)
+	}()
+	// overrides are applied to a copy as the transformer is shared by concurrent runs
+	cfg := this.Config.Clone()
+	// only configured fields are templates, values merged from the object are used verbatim
+	if err := cfg.render(ctx.Object); err != nil {
+		return err
 	}
-
-	this.Config.MergeMap(mp)
-
-	client, err := this.Config.CreateHttpClient()
-	if err != nil {
+	if mp, ok := ctx.Object.(map[string]any); ok {
+		if err := cfg.MergeMap(requestOverrides(mp)); err != nil {
+			return err
+		}
+	}
+	cfg.registerSecrets()
+	if err := cfg.validate(); err != nil {
 		return err
 	}
-	req, err := this.Config.CreateHttpRequest()
+
+	client, err := cfg.HttpClient()
 	if err != nil {
 		return err
 	}
-	resp, err := client.Do(req)
+	if cfg.Pagination.Strategy != "" {
+		pages, err := cfg.paginate(ctx.Ctx(), client)
+		if err != nil {
+			return err
+		}
+		ctx.Result = pages
+		return nil
+	}
+	resp, err := cfg.do(ctx.Ctx(), client)
 	if err != nil {
 		return err
 	}
 
-	obj, err := responseToMap(resp)
+	obj, _, err := cfg.responseToMap(resp, false)
 	if err != nil {
 		return err
 	}
@@ -314,7 +503,41 @@ func (this *httpTransformer) Transform(ctx *transformer.TransformationContext) e
 	return nil
 }
 
-func responseToMap(resp *http.Response) (map[string]any, error) {
+// responseKeys are produced by the transformer itself, besides body
+var responseKeys = []string{"status", "status_code", "headers", "raw_body"}
+
+// requestOverrides returns the fields of object that override the config. When object is the response of a
+// previous http step, the fields it produced are not request fields, e.g. its headers are not sent.
+func requestOverrides(object map[string]any) map[string]any {
+	if _, ok := object["status_code"]; !ok {
+		return object
+	}
+	overrides := maps.Clone(object)
+	for _, key := range responseKeys {
+		delete(overrides, key)
+	}
+	return overrides
+}
+
+// responseToMap reads resp, checks its status and decodes the body, required2xx applies when expect_status is empty.
+// In stream mode the body is left open and wrapped into a stream, the returned bytes are nil then.
+func (c *HttpTargetConfig) responseToMap(resp *http.Response, required2xx bool) (map[string]any, []byte, error) {
+	result := map[string]any{
+		"status":      resp.Status,
+		"status_code": resp.StatusCode,
+		"headers":     headersToMap(resp.Header),
+	}
+
+	if c.Stream != "" && c.acceptsStatus(resp.StatusCode, required2xx) {
+		stream, err := c.newStream(resp.Body)
+		if err != nil {
+			resp.Body.Close()
+			return nil, nil, err
+		}
+		result["body"] = stream
+		return result, nil, nil
+	}
+
 	bodyBytes := []byte{}
 	if resp.Body != nil {
 
@@ -322,15 +545,32 @@ func responseToMap(resp *http.Response) (map[string]any, error) {
 
 		// Read full response body
 		var err error
-		bodyBytes, err = io.ReadAll(resp.Body)
+		bodyBytes, err = io.ReadAll(limitBody(resp.Body, c.MaxResponseBytes))
 		if err != nil {
-			return nil, err
+			return nil, nil, fmt.Errorf("cannot read response of %s %q: %w", resp.Request.Method, resp.Request.URL.Redacted(), err)
 		}
 	}
+	if err := c.checkStatus(resp, bodyBytes, required2xx); err != nil {
+		return nil, nil, err
+	}
+
+	result["body"] = bodyBytes
+	if c.ResponseDecoding != "" {
+		body, err := decodeBody(bodyBytes, resp.Header.Get("Content-Type"), c.ResponseDecoding)
+		if err != nil {
+			return nil, nil, err
+		}
+		result["body"] = body
+		result["raw_body"] = bodyBytes
+	}
+
+	return result, bodyBytes, nil
+}
 
-	// Convert headers to map[string]string (joining multiple values by comma)
+// headersToMap converts headers to map[string]string (joining multiple values by comma)
+func headersToMap(header http.Header) map[string]string {
 	headers := make(map[string]string)
-	for k, vals := range resp.Header {
+	for k, vals := range header {
 		// Join multiple values with comma as per RFC 7230 section 3.2.2
 		joined := ""
 		for i, v := range vals {
@@ -341,13 +581,5 @@ func responseToMap(resp *http.Response) (map[string]any, error) {
 		}
 		headers[k] = joined
 	}
-
-	result := map[string]any{
-		"status":      resp.Status,
-		"status_code": resp.StatusCode,
-		"headers":     headers,
-		"body":        bodyBytes,
-	}
-
-	return result, nil
+	return headers
 }
@@ -0,0 +1,63 @@
+package http
+
+import "container/list"
+
+// lru is a map holding at most size entries, adding to a full one evicts the least recently used entry.
+// It is not safe for concurrent use.
+type lru[K comparable, V any] struct {
+	size    int
+	order   *list.List // of *lruEntry, most recently used first
+	entries map[K]*list.Element
+	evicted func(V)
+}
+
+type lruEntry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+func newLRU[K comparable, V any](size int, evicted func(V)) *lru[K, V] {
+	return &lru[K, V]{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[K]*list.Element),
+		evicted: evicted,
+	}
+}
+
+func (this *lru[K, V]) get(key K) (V, bool) {
+	elem, ok := this.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	this.order.MoveToFront(elem)
+	return elem.Value.(*lruEntry[K, V]).value, true
+}
+
+func (this *lru[K, V]) add(key K, value V) {
+	if elem, ok := this.entries[key]; ok {
+		elem.Value.(*lruEntry[K, V]).value = value
+		this.order.MoveToFront(elem)
+		return
+	}
+	this.entries[key] = this.order.PushFront(&lruEntry[K, V]{key: key, value: value})
+	for this.order.Len() > this.size {
+		this.remove(this.order.Back())
+	}
+}
+
+// clear evicts every entry
+func (this *lru[K, V]) clear() {
+	for this.order.Len() > 0 {
+		this.remove(this.order.Back())
+	}
+}
+
+func (this *lru[K, V]) remove(elem *list.Element) {
+	entry := this.order.Remove(elem).(*lruEntry[K, V])
+	delete(this.entries, entry.key)
+	if this.evicted != nil {
+		this.evicted(entry.value)
+	}
+}
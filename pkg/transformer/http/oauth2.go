@@ -0,0 +1,262 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vitrevance/api-exporter/pkg/secret"
+)
+
+const (
+	GrantClientCredentials = "client_credentials"
+	GrantRefreshToken      = "refresh_token"
+)
+
+// tokenExpiryDelta refreshes tokens a bit before they actually expire
+const tokenExpiryDelta = 10 * time.Second
+
+type OAuth2Config struct {
+	// Token endpoint, required
+	TokenURL string `yaml:"token_url"`
+
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	Scopes       []string `yaml:"scopes"`
+
+	// client_credentials (default) or refresh_token
+	GrantType string `yaml:"grant_type"`
+
+	// Initial refresh token for the refresh_token grant, replaced by tokens the server rotates
+	RefreshToken string `yaml:"refresh_token"`
+
+	// Send client credentials as form parameters instead of basic auth
+	CredentialsInBody bool `yaml:"credentials_in_body"`
+
+	// Additional parameters of the token request
+	EndpointParams map[string]string `yaml:"endpoint_params"`
+}
+
+func (c *OAuth2Config) MergeMap(cfg map[string]any) error {
+	for key, value := range cfg {
+		switch key {
+		case "token_url", "client_id", "client_secret", "grant_type", "refresh_token":
+			v, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("invalid type for oauth2.%s, expected string", key)
+			}
+			switch key {
+			case "token_url":
+				c.TokenURL = v
+			case "client_id":
+				c.ClientID = v
+			case "client_secret":
+				c.ClientSecret = v
+			case "grant_type":
+				c.GrantType = v
+			case "refresh_token":
+				c.RefreshToken = v
+			}
+		case "scopes":
+			arr, ok := value.([]any)
+			if !ok {
+				return fmt.Errorf("invalid type for oauth2.scopes, expected array")
+			}
+			c.Scopes = make([]string, 0, len(arr))
+			for _, v := range arr {
+				s, ok := v.(string)
+				if !ok {
+					return fmt.Errorf("invalid type for oauth2.scopes, expected array of strings")
+				}
+				c.Scopes = append(c.Scopes, s)
+			}
+		case "credentials_in_body":
+			if bv, ok := value.(bool); ok {
+				c.CredentialsInBody = bv
+			} else {
+				return fmt.Errorf("invalid type for oauth2.credentials_in_body, expected bool")
+			}
+		case "endpoint_params":
+			m, ok := value.(map[string]any)
+			if !ok {
+				return fmt.Errorf("invalid type for oauth2.endpoint_params, expected map[string]any")
+			}
+			c.EndpointParams = make(map[string]string, len(m))
+			for pk, pv := range m {
+				ps, ok := pv.(string)
+				if !ok {
+					return fmt.Errorf("invalid oauth2 endpoint param value type for %s, expected string", pk)
+				}
+				c.EndpointParams[pk] = ps
+			}
+		}
+	}
+	return nil
+}
+
+func (c *OAuth2Config) validate() error {
+	if c.TokenURL == "" {
+		return fmt.Errorf("oauth2.token_url must be specified")
+	}
+	switch c.GrantType {
+	case "", GrantClientCredentials:
+	case GrantRefreshToken:
+		if c.RefreshToken == "" {
+			return fmt.Errorf("oauth2 refresh_token grant requires refresh_token")
+		}
+	default:
+		return fmt.Errorf("unknown oauth2 grant_type %q, expecting client_credentials or refresh_token", c.GrantType)
+	}
+	return nil
+}
+
+// cacheKey identifies tokens that can be shared between steps and jobs
+func (c *OAuth2Config) cacheKey() string {
+	scopes := slices.Clone(c.Scopes)
+	slices.Sort(scopes)
+	params := make([]string, 0, len(c.EndpointParams))
+	for k, v := range c.EndpointParams {
+		params = append(params, k+"="+v)
+	}
+	slices.Sort(params)
+	return strings.Join([]string{
+		c.TokenURL, c.ClientID, c.ClientSecret, c.GrantType, c.RefreshToken,
+		strings.Join(scopes, " "), strings.Join(params, "&"),
+	}, "\x00")
+}
+
+type oauth2Token struct {
+	accessToken string
+	tokenType   string
+	expiry      time.Time
+}
+
+func (t *oauth2Token) valid() bool {
+	return t != nil && t.accessToken != "" && (t.expiry.IsZero() || time.Now().Add(tokenExpiryDelta).Before(t.expiry))
+}
+
+// tokenSource caches the token of a single OAuth2 config
+type tokenSource struct {
+	mu           sync.Mutex
+	token        *oauth2Token
+	refreshToken string
+}
+
+// maxTokenSources bounds the cached tokens, an evicted refresh_token source starts over from the configured refresh token
+const maxTokenSources = 256
+
+var (
+	tokenSourcesMu sync.Mutex
+	tokenSources   = newLRU[string, *tokenSource](maxTokenSources, nil)
+)
+
+func (c *OAuth2Config) source() *tokenSource {
+	key := c.cacheKey()
+	tokenSourcesMu.Lock()
+	defer tokenSourcesMu.Unlock()
+	src, ok := tokenSources.get(key)
+	if !ok {
+		src = &tokenSource{refreshToken: c.RefreshToken}
+		tokenSources.add(key, src)
+	}
+	return src
+}
+
+// token returns a cached token or fetches a new one, a cached token equal to stale is never returned
+func (c *OAuth2Config) token(ctx context.Context, client *http.Client, stale string) (*oauth2Token, error) {
+	src := c.source()
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	if src.token.valid() && src.token.accessToken != stale {
+		return src.token, nil
+	}
+
+	form := url.Values{}
+	switch c.GrantType {
+	case GrantRefreshToken:
+		form.Set("grant_type", GrantRefreshToken)
+		form.Set("refresh_token", src.refreshToken)
+	default:
+		form.Set("grant_type", GrantClientCredentials)
+	}
+	if len(c.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.Scopes, " "))
+	}
+	for k, v := range c.EndpointParams {
+		form.Set(k, v)
+	}
+	if c.CredentialsInBody {
+		form.Set("client_id", c.ClientID)
+		form.Set("client_secret", c.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if !c.CredentialsInBody && c.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(c.ClientID), url.QueryEscape(c.ClientSecret))
+	}
+
+	resp, err := send(client, req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch oauth2 token from %q: %w", c.TokenURL, err)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		if len(data) > 4*1024 {
+			data = data[:4*1024]
+		}
+		return nil, fmt.Errorf("unexpected status code when fetching oauth2 token from %q: %d, expecting %d; response: %q", c.TokenURL, resp.StatusCode, http.StatusOK, data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read oauth2 token from %q: %w", c.TokenURL, err)
+	}
+
+	var body struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    any    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, fmt.Errorf("cannot decode oauth2 token from %q: %w", c.TokenURL, err)
+	}
+	if body.AccessToken == "" {
+		return nil, fmt.Errorf("oauth2 token response from %q has no access_token", c.TokenURL)
+	}
+
+	secret.Register(body.AccessToken)
+	secret.Register(body.RefreshToken)
+	token := &oauth2Token{
+		accessToken: body.AccessToken,
+		tokenType:   body.TokenType,
+	}
+	if token.tokenType == "" || strings.EqualFold(token.tokenType, "bearer") {
+		token.tokenType = "Bearer"
+	}
+	switch v := body.ExpiresIn.(type) {
+	case float64:
+		token.expiry = time.Now().Add(time.Duration(v) * time.Second)
+	case string:
+		if seconds, err := strconv.Atoi(v); err == nil {
+			token.expiry = time.Now().Add(time.Duration(seconds) * time.Second)
+		}
+	}
+	if body.RefreshToken != "" {
+		src.refreshToken = body.RefreshToken
+	}
+	src.token = token
+	return token, nil
+}
@@ -0,0 +1,343 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/vitrevance/api-exporter/pkg/secret"
+	"github.com/vitrevance/api-exporter/pkg/transformer"
+)
+
+const (
+	PaginationLink   = "link"
+	PaginationCursor = "cursor"
+	PaginationPage   = "page"
+	PaginationOffset = "offset"
+)
+
+type PaginationConfig struct {
+	// link (RFC 5988 Link header with rel=next), cursor, page or offset; pagination is disabled if empty
+	Strategy string `yaml:"strategy"`
+
+	// Query parameter receiving the cursor, page number or offset
+	Param string `yaml:"param"`
+
+	// Field path of the next cursor in the JSON response body, pagination stops when it is missing or empty
+	CursorPath string `yaml:"cursor_path"`
+
+	// First page number or offset (default 1 for page and 0 for offset)
+	Start *int `yaml:"start"`
+
+	// Query parameter receiving the page size and its value, required for offset
+	LimitParam string `yaml:"limit_param"`
+	Limit      int    `yaml:"limit"`
+
+	// Field path of the items array in the JSON response body.
+	// When set the result is an array of items of all pages, otherwise an array of responses.
+	// Page and offset pagination stops on a page with fewer items than limit or with no items.
+	ItemsPath string `yaml:"items_path"`
+
+	// Field path of a boolean in the JSON response body telling whether more pages exist
+	HasMorePath string `yaml:"has_more_path"`
+
+	// Maximum number of requested pages (default 100)
+	MaxPages int `yaml:"max_pages"`
+}
+
+func NewPaginationConfig() PaginationConfig {
+	return PaginationConfig{
+		MaxPages: 100,
+	}
+}
+
+func (c *PaginationConfig) MergeMap(cfg map[string]any) error {
+	for key, value := range cfg {
+		switch key {
+		case "strategy", "param", "cursor_path", "limit_param", "items_path", "has_more_path":
+			v, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("invalid type for pagination.%s, expected string", key)
+			}
+			switch key {
+			case "strategy":
+				c.Strategy = v
+			case "param":
+				c.Param = v
+			case "cursor_path":
+				c.CursorPath = v
+			case "limit_param":
+				c.LimitParam = v
+			case "items_path":
+				c.ItemsPath = v
+			case "has_more_path":
+				c.HasMorePath = v
+			}
+		case "start", "limit", "max_pages":
+			iv, err := toInt(value)
+			if err != nil {
+				return fmt.Errorf("invalid type for pagination.%s: %v", key, err)
+			}
+			switch key {
+			case "start":
+				c.Start = &iv
+			case "limit":
+				c.Limit = iv
+			case "max_pages":
+				c.MaxPages = iv
+			}
+		}
+	}
+	return nil
+}
+
+func (c *PaginationConfig) validate() error {
+	switch c.Strategy {
+	case "", PaginationLink:
+	case PaginationCursor:
+		if c.Param == "" || c.CursorPath == "" {
+			return fmt.Errorf("cursor pagination requires param and cursor_path")
+		}
+	case PaginationPage:
+		if c.Param == "" {
+			return fmt.Errorf("page pagination requires param")
+		}
+		if c.ItemsPath == "" && c.HasMorePath == "" {
+			return fmt.Errorf("page pagination requires items_path or has_more_path to stop")
+		}
+	case PaginationOffset:
+		if c.Param == "" || c.LimitParam == "" || c.Limit <= 0 {
+			return fmt.Errorf("offset pagination requires param, limit_param and positive limit")
+		}
+		if c.ItemsPath == "" && c.HasMorePath == "" {
+			return fmt.Errorf("offset pagination requires items_path or has_more_path to stop")
+		}
+	default:
+		return fmt.Errorf("unknown pagination strategy %q, expecting link, cursor, page or offset", c.Strategy)
+	}
+	if c.MaxPages < 1 {
+		return fmt.Errorf("pagination.max_pages must be at least 1")
+	}
+	return nil
+}
+
+// paginate requests pages until the configured strategy finds no next page or max_pages is reached
+func (c *HttpTargetConfig) paginate(ctx context.Context, client *http.Client) ([]any, error) {
+	p := &c.Pagination
+	page := c.Clone()
+	if page.QueryParams == nil {
+		page.QueryParams = make(map[string]string)
+	}
+
+	position := 0
+	switch {
+	case p.Start != nil:
+		position = *p.Start
+	case p.Strategy == PaginationPage:
+		position = 1
+	}
+	if p.Strategy == PaginationPage || p.Strategy == PaginationOffset {
+		page.QueryParams[p.Param] = strconv.Itoa(position)
+	}
+	if p.LimitParam != "" && p.Limit > 0 {
+		page.QueryParams[p.LimitParam] = strconv.Itoa(p.Limit)
+	}
+
+	result := make([]any, 0)
+	for n := 1; ; n++ {
+		resp, err := page.do(ctx, client)
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %w", n, err)
+		}
+		// a page with an error status has no next page information, so 2xx is required by default
+		obj, raw, err := page.responseToMap(resp, true)
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %w", n, err)
+		}
+
+		var body any
+		if p.ItemsPath != "" || p.CursorPath != "" || p.HasMorePath != "" {
+			if err := json.Unmarshal(raw, &body); err != nil {
+				return nil, fmt.Errorf("page %d: cannot decode JSON body: %w", n, err)
+			}
+		}
+
+		items := -1
+		if p.ItemsPath != "" {
+			v, _ := transformer.Lookup(body, p.ItemsPath)
+			arr, ok := v.([]any)
+			if !ok && v != nil {
+				return nil, fmt.Errorf("page %d: %s is not an array", n, p.ItemsPath)
+			}
+			result = append(result, arr...)
+			items = len(arr)
+		} else {
+			result = append(result, obj)
+		}
+
+		more := true
+		if p.HasMorePath != "" {
+			v, _ := transformer.Lookup(body, p.HasMorePath)
+			more, _ = v.(bool)
+		}
+		switch p.Strategy {
+		case PaginationLink:
+			next := nextLink(resp)
+			if next == "" {
+				return result, nil
+			}
+			nextURL, err := resp.Request.URL.Parse(next)
+			if err != nil {
+				return nil, fmt.Errorf("page %d: invalid next link %q: %w", n, next, err)
+			}
+			if !sameOrSubdomain(c.URL, nextURL) {
+				page.dropCredentials()
+			}
+			page.URL = nextURL.String()
+			// the next link carries all query parameters of the next page
+			page.QueryParams = nil
+		case PaginationCursor:
+			v, _ := transformer.Lookup(body, p.CursorPath)
+			if v == nil || v == "" || !more {
+				return result, nil
+			}
+			page.QueryParams[p.Param] = formatCursor(v)
+		case PaginationPage, PaginationOffset:
+			if !more || items == 0 || (p.Limit > 0 && items >= 0 && items < p.Limit) {
+				return result, nil
+			}
+			if p.Strategy == PaginationPage {
+				position++
+			} else {
+				position += p.Limit
+			}
+			page.QueryParams[p.Param] = strconv.Itoa(position)
+		}
+
+		if n >= p.MaxPages {
+			log.Printf("[WARN] pagination of %s stopped at max_pages %d", c.URL, p.MaxPages)
+			return result, nil
+		}
+	}
+}
+
+// formatCursor formats a cursor of the JSON body, numbers never use the exponent notation
+func formatCursor(v any) string {
+	if f, ok := v.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// sameOrSubdomain reports whether credentials for initial may be sent to next, following the rules net/http applies to redirects
+func sameOrSubdomain(initial string, next *url.URL) bool {
+	u, err := url.Parse(initial)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	nextHost := strings.ToLower(next.Hostname())
+	return nextHost == host || strings.HasSuffix(nextHost, "."+host)
+}
+
+// dropCredentials removes authentication of the request, e.g. before following a link to another host
+func (c *HttpTargetConfig) dropCredentials() {
+	for k := range c.Headers {
+		if secret.IsSensitiveName(k) {
+			delete(c.Headers, k)
+		}
+	}
+	c.BasicAuthUsername = ""
+	c.BasicAuthPassword = ""
+	c.OAuth2 = nil
+}
+
+// nextLink returns the target of the rel="next" link of the Link header
+func nextLink(resp *http.Response) string {
+	for _, header := range resp.Header.Values("Link") {
+		for _, link := range parseLinks(header) {
+			for _, rel := range strings.Fields(link.params["rel"]) {
+				if strings.EqualFold(rel, "next") {
+					return link.target
+				}
+			}
+		}
+	}
+	return ""
+}
+
+type link struct {
+	target string
+	params map[string]string
+}
+
+// parseLinks parses a Link header as of RFC 8288, targets and quoted parameter values may contain commas and semicolons
+func parseLinks(header string) []link {
+	var links []link
+	s := header
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if !strings.HasPrefix(s, "<") {
+			return links
+		}
+		end := strings.IndexByte(s, '>')
+		if end < 0 {
+			return links
+		}
+		l := link{target: s[1:end], params: make(map[string]string)}
+		s = s[end+1:]
+		for {
+			s = strings.TrimLeft(s, " \t")
+			if !strings.HasPrefix(s, ";") {
+				break
+			}
+			s = strings.TrimLeft(s[1:], " \t")
+			nameEnd := strings.IndexAny(s, "=;, \t")
+			if nameEnd < 0 {
+				nameEnd = len(s)
+			}
+			name := strings.ToLower(s[:nameEnd])
+			s = strings.TrimLeft(s[nameEnd:], " \t")
+			value := ""
+			if strings.HasPrefix(s, "=") {
+				value, s = parseLinkParamValue(strings.TrimLeft(s[1:], " \t"))
+			}
+			// only the first occurrence of a parameter counts
+			if _, ok := l.params[name]; !ok && name != "" {
+				l.params[name] = value
+			}
+		}
+		links = append(links, l)
+	}
+}
+
+// parseLinkParamValue reads a token or a quoted string from the start of s and returns it with the rest of s
+func parseLinkParamValue(s string) (string, string) {
+	if !strings.HasPrefix(s, `"`) {
+		end := strings.IndexAny(s, ";, \t")
+		if end < 0 {
+			end = len(s)
+		}
+		return s[:end], s[end:]
+	}
+	var value strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				value.WriteByte(s[i])
+			}
+		case '"':
+			return value.String(), s[i+1:]
+		default:
+			value.WriteByte(s[i])
+		}
+	}
+	return value.String(), ""
+}
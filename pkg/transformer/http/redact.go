@@ -0,0 +1,45 @@
+package http
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/vitrevance/api-exporter/pkg/secret"
+)
+
+// registerSecrets marks credentials of the rendered config as secrets, so they are redacted from logs and errors
+func (c *HttpTargetConfig) registerSecrets() {
+	secret.Register(c.BasicAuthPassword)
+	registerURLPassword(c.URL)
+	registerURLPassword(c.ProxyURL)
+	registerSensitive(c.Headers)
+	registerSensitive(c.QueryParams)
+	if c.OAuth2 != nil {
+		secret.Register(c.OAuth2.ClientSecret)
+		secret.Register(c.OAuth2.RefreshToken)
+		registerSensitive(c.OAuth2.EndpointParams)
+	}
+}
+
+func registerSensitive(values map[string]string) {
+	for k, v := range values {
+		if !secret.IsSensitiveName(k) {
+			continue
+		}
+		secret.Register(v)
+		// credentials of values like "Bearer <token>" are secret on their own too
+		if _, credentials, ok := strings.Cut(v, " "); ok {
+			secret.Register(strings.TrimSpace(credentials))
+		}
+	}
+}
+
+func registerURLPassword(rawURL string) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return
+	}
+	if password, ok := u.User.Password(); ok {
+		secret.Register(password)
+	}
+}
@@ -0,0 +1,243 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vitrevance/api-exporter/pkg/metrics"
+)
+
+type RetryConfig struct {
+	// Total number of attempts including the first one (default 1, no retries)
+	MaxAttempts int `yaml:"max_attempts"`
+
+	// Backoff before the first retry, doubled on each next one up to MaxBackoffMillis
+	InitialBackoffMillis int `yaml:"initial_backoff_ms"`
+	MaxBackoffMillis     int `yaml:"max_backoff_ms"`
+
+	// Fraction of the backoff randomly added or subtracted, from 0 to 1
+	Jitter float64 `yaml:"jitter"`
+
+	// Response status codes that are retried, connection errors are always retried
+	StatusCodes []int `yaml:"status_codes"`
+
+	// Request methods that are retried (default idempotent methods)
+	Methods []string `yaml:"methods"`
+}
+
+// NewRetryConfig returns a config that makes a single attempt but retries reasonably once max_attempts is set
+func NewRetryConfig() RetryConfig {
+	return RetryConfig{
+		MaxAttempts:          1,
+		InitialBackoffMillis: 500,
+		MaxBackoffMillis:     30000,
+		Jitter:               0.2,
+		StatusCodes:          []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+		Methods:              []string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete},
+	}
+}
+
+func (c *RetryConfig) MergeMap(cfg map[string]any) error {
+	for key, value := range cfg {
+		switch key {
+		case "max_attempts":
+			if iv, err := toInt(value); err == nil {
+				c.MaxAttempts = iv
+			} else {
+				return fmt.Errorf("invalid type for retry.max_attempts: %v", err)
+			}
+		case "initial_backoff_ms":
+			if iv, err := toInt(value); err == nil {
+				c.InitialBackoffMillis = iv
+			} else {
+				return fmt.Errorf("invalid type for retry.initial_backoff_ms: %v", err)
+			}
+		case "max_backoff_ms":
+			if iv, err := toInt(value); err == nil {
+				c.MaxBackoffMillis = iv
+			} else {
+				return fmt.Errorf("invalid type for retry.max_backoff_ms: %v", err)
+			}
+		case "jitter":
+			switch v := value.(type) {
+			case float64:
+				c.Jitter = v
+			case int:
+				c.Jitter = float64(v)
+			case int64:
+				c.Jitter = float64(v)
+			default:
+				return fmt.Errorf("invalid type for retry.jitter, expected number")
+			}
+		case "status_codes":
+			arr, ok := value.([]any)
+			if !ok {
+				return fmt.Errorf("invalid type for retry.status_codes, expected array")
+			}
+			c.StatusCodes = make([]int, 0, len(arr))
+			for _, v := range arr {
+				iv, err := toInt(v)
+				if err != nil {
+					return fmt.Errorf("invalid type for retry.status_codes: %v", err)
+				}
+				c.StatusCodes = append(c.StatusCodes, iv)
+			}
+		case "methods":
+			arr, ok := value.([]any)
+			if !ok {
+				return fmt.Errorf("invalid type for retry.methods, expected array")
+			}
+			c.Methods = make([]string, 0, len(arr))
+			for _, v := range arr {
+				s, ok := v.(string)
+				if !ok {
+					return fmt.Errorf("invalid type for retry.methods, expected array of strings")
+				}
+				c.Methods = append(c.Methods, s)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *RetryConfig) validate() error {
+	if c.MaxAttempts < 1 {
+		return fmt.Errorf("retry.max_attempts must be at least 1")
+	}
+	if c.InitialBackoffMillis < 0 || c.MaxBackoffMillis < 0 {
+		return fmt.Errorf("retry backoff must not be negative")
+	}
+	if c.Jitter < 0 || c.Jitter > 1 {
+		return fmt.Errorf("retry.jitter must be between 0 and 1")
+	}
+	return nil
+}
+
+// backoff returns the delay before retry number attempt, starting from 1
+func (c *RetryConfig) backoff(attempt int) time.Duration {
+	d := time.Duration(c.InitialBackoffMillis) * time.Millisecond
+	maxBackoff := time.Duration(c.MaxBackoffMillis) * time.Millisecond
+	for i := 1; i < attempt && d < maxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, maxBackoff)
+	if c.Jitter > 0 {
+		d += time.Duration((rand.Float64()*2 - 1) * c.Jitter * float64(d))
+	}
+	return d
+}
+
+func (c *RetryConfig) retryable(method string) bool {
+	return slices.ContainsFunc(c.Methods, func(m string) bool {
+		return strings.EqualFold(m, method)
+	})
+}
+
+// parseRetryAfter reads the Retry-After header given either in seconds or as an HTTP date
+func parseRetryAfter(resp *http.Response) (time.Duration, bool) {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// do sends the configured request retrying it according to the retry policy
+func (c *HttpTargetConfig) do(ctx context.Context, client *http.Client) (*http.Response, error) {
+	ctx = withResponseLimit(ctx, c.MaxResponseBytes)
+	for attempt := 1; ; attempt++ {
+		req, resp, err := c.sendAuthorized(ctx, client)
+		if req == nil {
+			return nil, err
+		}
+
+		if attempt >= c.Retry.MaxAttempts || !c.Retry.retryable(req.Method) || ctx.Err() != nil {
+			return resp, err
+		}
+		delay := c.Retry.backoff(attempt)
+		if err == nil {
+			if !slices.Contains(c.Retry.StatusCodes, resp.StatusCode) {
+				return resp, nil
+			}
+			if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+				if retryAfter, ok := parseRetryAfter(resp); ok {
+					delay = min(retryAfter, time.Duration(c.Retry.MaxBackoffMillis)*time.Millisecond)
+				}
+			}
+		}
+		// a retry that cannot start before the deadline would only hide the last outcome
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return resp, err
+		}
+		if err == nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			_ = resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			if err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("retry of %s %s aborted after status %d: %w", req.Method, req.URL.Redacted(), resp.StatusCode, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// sendAuthorized makes a single request with OAuth2 token if configured.
+// A 401 response invalidates the token and the request is repeated once with a fresh one.
+// The returned request is nil if it could not be built.
+func (c *HttpTargetConfig) sendAuthorized(ctx context.Context, client *http.Client) (*http.Request, *http.Response, error) {
+	stale := ""
+	for {
+		req, err := c.CreateHttpRequest(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		if c.OAuth2 == nil {
+			resp, err := send(client, req)
+			return req, resp, err
+		}
+		token, err := c.OAuth2.token(ctx, client, stale)
+		if err != nil {
+			return req, nil, err
+		}
+		req.Header.Set("Authorization", token.tokenType+" "+token.accessToken)
+		resp, err := send(client, req)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized || stale != "" {
+			return req, resp, err
+		}
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+		_ = resp.Body.Close()
+		stale = token.accessToken
+	}
+}
+
+// send makes a single request and records it in metrics
+func send(client *http.Client, req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := client.Do(req)
+	metrics.HTTPRequestDuration.WithLabelValues(req.Method, req.URL.Host).Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.HTTPRequests.WithLabelValues(req.Method, req.URL.Host, "error").Inc()
+		return nil, err
+	}
+	metrics.HTTPRequests.WithLabelValues(req.Method, req.URL.Host, strconv.Itoa(resp.StatusCode)).Inc()
+	return resp, nil
+}
@@ -0,0 +1,88 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxErrorBodyLen limits the response body quoted in errors
+const maxErrorBodyLen = 4 * 1024
+
+type statusRange struct {
+	from, to int
+}
+
+// parseExpectStatus accepts codes like 200, classes like 2xx and ranges like 200-204
+func parseExpectStatus(patterns []string) ([]statusRange, error) {
+	ranges := make([]statusRange, 0, len(patterns))
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		switch {
+		case len(p) == 3 && strings.HasSuffix(strings.ToLower(p), "xx"):
+			class, err := strconv.Atoi(p[:1])
+			if err != nil || class < 1 || class > 5 {
+				return nil, fmt.Errorf("invalid expect_status %q", p)
+			}
+			ranges = append(ranges, statusRange{class * 100, class*100 + 99})
+		case strings.Contains(p, "-"):
+			fromStr, toStr, _ := strings.Cut(p, "-")
+			from, err1 := strconv.Atoi(strings.TrimSpace(fromStr))
+			to, err2 := strconv.Atoi(strings.TrimSpace(toStr))
+			if err1 != nil || err2 != nil || from > to {
+				return nil, fmt.Errorf("invalid expect_status %q", p)
+			}
+			ranges = append(ranges, statusRange{from, to})
+		default:
+			code, err := strconv.Atoi(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid expect_status %q", p)
+			}
+			ranges = append(ranges, statusRange{code, code})
+		}
+	}
+	return ranges, nil
+}
+
+// expectedStatus returns expect_status or the 2xx class if it is empty and required2xx is set
+func (c *HttpTargetConfig) expectedStatus(required2xx bool) []string {
+	if len(c.ExpectStatus) == 0 && required2xx {
+		return []string{"2xx"}
+	}
+	return c.ExpectStatus
+}
+
+// acceptsStatus reports whether code matches the expected status, any code matches if none is expected
+func (c *HttpTargetConfig) acceptsStatus(code int, required2xx bool) bool {
+	patterns := c.expectedStatus(required2xx)
+	if len(patterns) == 0 {
+		return true
+	}
+	ranges, err := parseExpectStatus(patterns)
+	if err != nil {
+		return false
+	}
+	for _, r := range ranges {
+		if code >= r.from && code <= r.to {
+			return true
+		}
+	}
+	return false
+}
+
+// checkStatus returns an error with the truncated response body if status does not match expect_status.
+// Without expect_status any status is accepted unless required2xx is set.
+func (c *HttpTargetConfig) checkStatus(resp *http.Response, body []byte, required2xx bool) error {
+	if c.acceptsStatus(resp.StatusCode, required2xx) {
+		return nil
+	}
+	if _, err := parseExpectStatus(c.ExpectStatus); err != nil {
+		return err
+	}
+	if len(body) > maxErrorBodyLen {
+		body = body[:maxErrorBodyLen]
+	}
+	return fmt.Errorf("unexpected status code when requesting %s %q: %d, expecting %s; response: %q",
+		resp.Request.Method, resp.Request.URL.Redacted(), resp.StatusCode, strings.Join(c.expectedStatus(required2xx), ", "), body)
+}
@@ -0,0 +1,185 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	StreamJSON   = "json"
+	StreamNDJSON = "ndjson"
+)
+
+// limitedReader fails with a clear error instead of silently truncating the body at limit bytes
+type limitedReader struct {
+	r     io.Reader
+	limit int64
+	read  int64
+}
+
+func limitBody(r io.Reader, limit int64) io.Reader {
+	if limit <= 0 {
+		return r
+	}
+	return &limitedReader{r: r, limit: limit}
+}
+
+func (this *limitedReader) Read(p []byte) (int, error) {
+	if this.read >= this.limit {
+		// probe for a byte past the limit to tell an exact fit from an oversized body
+		var b [1]byte
+		n, err := this.r.Read(b[:])
+		if n > 0 {
+			return 0, fmt.Errorf("response body exceeds max_response_bytes of %d bytes", this.limit)
+		}
+		return 0, err
+	}
+	if int64(len(p)) > this.limit-this.read {
+		p = p[:this.limit-this.read]
+	}
+	n, err := this.r.Read(p)
+	this.read += int64(n)
+	return n, err
+}
+
+// jsonStream yields elements of a JSON array found at path of object keys in the body
+type jsonStream struct {
+	body    io.ReadCloser
+	dec     *json.Decoder
+	path    []string
+	started bool
+	done    bool
+}
+
+func (this *jsonStream) start() error {
+	for _, key := range this.path {
+		if err := expectDelim(this.dec, '{'); err != nil {
+			return err
+		}
+		for {
+			if !this.dec.More() {
+				return fmt.Errorf("stream_path field %s not found", key)
+			}
+			tok, err := this.dec.Token()
+			if err != nil {
+				return err
+			}
+			if tok == key {
+				break
+			}
+			var skip json.RawMessage
+			if err := this.dec.Decode(&skip); err != nil {
+				return err
+			}
+		}
+	}
+	return expectDelim(this.dec, '[')
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != delim {
+		return fmt.Errorf("expected %v in JSON stream, got %v", delim, tok)
+	}
+	return nil
+}
+
+func (this *jsonStream) Next() (any, error) {
+	if this.done {
+		return nil, io.EOF
+	}
+	if !this.started {
+		this.started = true
+		if err := this.start(); err != nil {
+			this.Close()
+			return nil, fmt.Errorf("cannot stream JSON array: %w", err)
+		}
+	}
+	if !this.dec.More() {
+		this.Close()
+		return nil, io.EOF
+	}
+	var v any
+	if err := this.dec.Decode(&v); err != nil {
+		this.Close()
+		return nil, fmt.Errorf("cannot decode JSON stream element: %w", err)
+	}
+	return v, nil
+}
+
+func (this *jsonStream) Close() error {
+	this.done = true
+	return this.body.Close()
+}
+
+// ndjsonStream yields a decoded value per non-empty line of the body
+type ndjsonStream struct {
+	body    io.ReadCloser
+	scanner *bufio.Scanner
+	line    int
+	done    bool
+}
+
+func (this *ndjsonStream) Next() (any, error) {
+	if this.done {
+		return nil, io.EOF
+	}
+	for this.scanner.Scan() {
+		this.line++
+		line := bytes.TrimSpace(this.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var v any
+		if err := json.Unmarshal(line, &v); err != nil {
+			this.Close()
+			return nil, fmt.Errorf("cannot decode NDJSON line %d: %w", this.line, err)
+		}
+		return v, nil
+	}
+	err := this.scanner.Err()
+	this.Close()
+	if err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func (this *ndjsonStream) Close() error {
+	this.done = true
+	return this.body.Close()
+}
+
+// newStream wraps body into a stream of records, the stream closes body
+func (c *HttpTargetConfig) newStream(body io.ReadCloser) (any, error) {
+	r := limitBody(body, c.MaxResponseBytes)
+	switch c.Stream {
+	case StreamJSON:
+		var path []string
+		if c.StreamPath != "" {
+			path = strings.Split(c.StreamPath, ".")
+		}
+		return &jsonStream{
+			body: body,
+			dec:  json.NewDecoder(r),
+			path: path,
+		}, nil
+	case StreamNDJSON:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		return &ndjsonStream{
+			body:    body,
+			scanner: scanner,
+		}, nil
+	default:
+		return nil, errors.New("unknown stream mode " + c.Stream)
+	}
+}
@@ -0,0 +1,154 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// templateFuncs are helpers available in templated request fields
+var templateFuncs = template.FuncMap{
+	"pathEscape":  url.PathEscape,
+	"queryEscape": url.QueryEscape,
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"env": os.Getenv,
+	"now": func() time.Time {
+		return time.Now().UTC()
+	},
+	"formatTime": func(layout string, t any) (string, error) {
+		parsed, err := toTime(t)
+		if err != nil {
+			return "", err
+		}
+		return parsed.Format(layout), nil
+	},
+	"unix": func(t any) (int64, error) {
+		parsed, err := toTime(t)
+		if err != nil {
+			return 0, err
+		}
+		return parsed.Unix(), nil
+	},
+	"addDuration": func(d string, t any) (time.Time, error) {
+		parsed, err := toTime(t)
+		if err != nil {
+			return time.Time{}, err
+		}
+		duration, err := time.ParseDuration(d)
+		return parsed.Add(duration), err
+	},
+}
+
+// toTime accepts time.Time, RFC 3339 strings and unix seconds
+func toTime(v any) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case string:
+		return time.Parse(time.RFC3339, t)
+	case int:
+		return time.Unix(int64(t), 0).UTC(), nil
+	case int64:
+		return time.Unix(t, 0).UTC(), nil
+	case float64:
+		return time.Unix(int64(t), 0).UTC(), nil
+	default:
+		return time.Time{}, fmt.Errorf("cannot convert %T to time", v)
+	}
+}
+
+var templates sync.Map // string -> *template.Template
+
+func parseTemplate(text string) (*template.Template, error) {
+	if tmpl, ok := templates.Load(text); ok {
+		return tmpl.(*template.Template), nil
+	}
+	tmpl, err := template.New("").Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	templates.Store(text, tmpl)
+	return tmpl, nil
+}
+
+// renderString executes text as a template if it contains actions
+func renderString(field, text string, data any) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	tmpl, err := parseTemplate(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid template in %s: %w", field, err)
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("cannot render %s: %w", field, err)
+	}
+	return sb.String(), nil
+}
+
+// templatedFields calls fn for every field of the request that may be a template
+func (c *HttpTargetConfig) templatedFields(fn func(field string, value *string) error) error {
+	fields := []struct {
+		name  string
+		value *string
+	}{
+		{"url", &c.URL},
+		{"basic_auth_username", &c.BasicAuthUsername},
+		{"basic_auth_password", &c.BasicAuthPassword},
+	}
+	for _, f := range fields {
+		if err := fn(f.name, f.value); err != nil {
+			return err
+		}
+	}
+	if body, ok := c.Body.(string); ok {
+		if err := fn("body", &body); err != nil {
+			return err
+		}
+		c.Body = body
+	}
+	for k, v := range c.Headers {
+		if err := fn("headers."+k, &v); err != nil {
+			return err
+		}
+		c.Headers[k] = v
+	}
+	for k, v := range c.QueryParams {
+		if err := fn("query_params."+k, &v); err != nil {
+			return err
+		}
+		c.QueryParams[k] = v
+	}
+	return nil
+}
+
+// checkTemplates reports templates that cannot be parsed
+func (c *HttpTargetConfig) checkTemplates() error {
+	return c.templatedFields(func(field string, value *string) error {
+		if !strings.Contains(*value, "{{") {
+			return nil
+		}
+		if _, err := parseTemplate(*value); err != nil {
+			return fmt.Errorf("invalid template in %s: %w", field, err)
+		}
+		return nil
+	})
+}
+
+// render replaces templated fields with their values evaluated against data
+func (c *HttpTargetConfig) render(data any) error {
+	return c.templatedFields(func(field string, value *string) error {
+		rendered, err := renderString(field, *value, data)
+		*value = rendered
+		return err
+	})
+}
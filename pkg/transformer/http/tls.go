@@ -0,0 +1,211 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// fileStamp tells whether a file changed since it was read
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func statFile(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+// tlsReloader provides the CA pool and client certificate, re-reading files when they change on disk
+type tlsReloader struct {
+	caFile   string
+	caPEM    string
+	certFile string
+	keyFile  string
+
+	mu        sync.Mutex
+	caStamp   fileStamp
+	pool      *x509.CertPool
+	certStamp [2]fileStamp
+	cert      *tls.Certificate
+}
+
+func (this *tlsReloader) rootCAs() (*x509.CertPool, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.caFile == "" {
+		if this.pool == nil {
+			this.pool = x509.NewCertPool()
+			if !this.pool.AppendCertsFromPEM([]byte(this.caPEM)) {
+				return nil, errors.New("no certificates found in tls_ca")
+			}
+		}
+		return this.pool, nil
+	}
+	stamp, err := statFile(this.caFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read tls_ca_file: %w", err)
+	}
+	if this.pool != nil && stamp == this.caStamp {
+		return this.pool, nil
+	}
+	data, err := os.ReadFile(this.caFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read tls_ca_file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %q", this.caFile)
+	}
+	this.pool = pool
+	this.caStamp = stamp
+	return pool, nil
+}
+
+func (this *tlsReloader) clientCertificate() (*tls.Certificate, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	certStamp, err := statFile(this.certFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read tls_cert_file: %w", err)
+	}
+	keyStamp, err := statFile(this.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read tls_key_file: %w", err)
+	}
+	stamps := [2]fileStamp{certStamp, keyStamp}
+	if this.cert != nil && stamps == this.certStamp {
+		return this.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(this.certFile, this.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load client certificate: %w", err)
+	}
+	this.cert = &cert
+	this.certStamp = stamps
+	return this.cert, nil
+}
+
+// verifyConnection verifies the server chain against the current CA pool.
+// It replaces the standard verification which cannot pick up a rotated pool.
+func (this *tlsReloader) verifyConnection(serverName string) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("server presented no certificates")
+		}
+		pool, err := this.rootCAs()
+		if err != nil {
+			return err
+		}
+		opts := x509.VerifyOptions{
+			DNSName:       serverName,
+			Roots:         pool,
+			Intermediates: x509.NewCertPool(),
+		}
+		if opts.DNSName == "" {
+			opts.DNSName = cs.ServerName
+		}
+		// any certificate of the CA would do without a name, IP addresses are not sent as SNI
+		if opts.DNSName == "" {
+			return errors.New("cannot verify the server certificate without a server name, set tls_server_name")
+		}
+		for _, cert := range cs.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		_, err = cs.PeerCertificates[0].Verify(opts)
+		return err
+	}
+}
+
+// dialTLS connects to addr with a clone of cfg that verifies the server for the dialed host, which VerifyConnection cannot learn otherwise
+func dialTLS(cfg *tls.Config) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		conf := cfg.Clone()
+		if conf.ServerName == "" {
+			conf.ServerName = host
+		}
+		verify := conf.VerifyConnection
+		conf.VerifyConnection = func(cs tls.ConnectionState) error {
+			if cs.ServerName == "" {
+				cs.ServerName = host
+			}
+			return verify(cs)
+		}
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		tlsConn := tls.Client(conn, conf)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+}
+
+// createTLSConfig builds the client TLS config, files are loaded once to report errors early
+func (c *HttpTargetConfig) createTLSConfig() (*tls.Config, error) {
+	cfg := &tls.Config{
+		InsecureSkipVerify: c.TLSInsecureSkipVerify,
+		ServerName:         c.TLSServerName,
+	}
+	if c.TLSMinVersion != "" {
+		version, ok := tlsVersions[c.TLSMinVersion]
+		if !ok {
+			return nil, fmt.Errorf("invalid tls_min_version %q, expecting 1.0, 1.1, 1.2 or 1.3", c.TLSMinVersion)
+		}
+		cfg.MinVersion = version
+	}
+	if c.TLSCAFile != "" && c.TLSCA != "" {
+		return nil, errors.New("tls_ca_file and tls_ca are mutually exclusive")
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return nil, errors.New("tls_cert_file and tls_key_file must be set together")
+	}
+
+	reloader := &tlsReloader{
+		caFile:   c.TLSCAFile,
+		caPEM:    c.TLSCA,
+		certFile: c.TLSCertFile,
+		keyFile:  c.TLSKeyFile,
+	}
+	if c.TLSCertFile != "" {
+		if _, err := reloader.clientCertificate(); err != nil {
+			return nil, err
+		}
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return reloader.clientCertificate()
+		}
+	}
+	if (c.TLSCAFile != "" || c.TLSCA != "") && !c.TLSInsecureSkipVerify {
+		if _, err := reloader.rootCAs(); err != nil {
+			return nil, err
+		}
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = reloader.verifyConnection(c.TLSServerName)
+	}
+	return cfg, nil
+}
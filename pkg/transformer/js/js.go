@@ -1,9 +1,11 @@
 package js
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/robertkrimen/otto"
+	"github.com/vitrevance/api-exporter/pkg/secret"
 	"github.com/vitrevance/api-exporter/pkg/transformer"
 	"gopkg.in/yaml.v3"
 )
@@ -12,16 +14,26 @@ type jsTransformer struct {
 	Script string `yaml:"script"`
 }
 
+// errInterrupted is raised inside the VM to abort a script when its context is done
+var errInterrupted = errors.New("script interrupted")
+
 func init() {
 	transformer.RegisterTransformerFactory("javascript", transformer.TransformerFactoryFunc(func(value *yaml.Node) (transformer.Transformer, error) {
 		t := &jsTransformer{}
-		err := value.Decode(t)
+		err := transformer.DecodeNode(value, t)
+		if err != nil {
+			return nil, err
+		}
 		t.Script = fmt.Sprintf("(function(){\n%s\n})()", t.Script)
-		return t, err
+		_, err = otto.New().Compile("", t.Script)
+		if err != nil {
+			return nil, fmt.Errorf("invalid script: %w", err)
+		}
+		return t, nil
 	}))
 }
 
-func (this *jsTransformer) Transform(ctx *transformer.TransformationContext) error {
+func (this *jsTransformer) Transform(ctx *transformer.TransformationContext) (err error) {
 	vm := otto.New()
 	vm.Set("source", ctx.Object)
 	vm.Set("target", ctx.Result)
@@ -29,18 +41,43 @@ func (this *jsTransformer) Transform(ctx *transformer.TransformationContext) err
 		tr := ctx.Transformers[name]
 		if tr != nil {
 			taskCtx := &transformer.TransformationContext{
+				Context:      ctx.Context,
 				Object:       args,
 				Result:       make(map[string]any),
 				Transformers: ctx.Transformers,
 			}
 			err := tr.Transform(taskCtx)
 			if err != nil {
-				return map[string]any{"error": err.Error()}
+				return map[string]any{"error": secret.Redact(err.Error())}
 			}
 			return taskCtx.Result
 		}
 		return map[string]any{"error": "undefined transformer"}
 	})
+
+	if done := ctx.Ctx().Done(); done != nil {
+		vm.Interrupt = make(chan func(), 1)
+		finished := make(chan struct{})
+		defer close(finished)
+		go func() {
+			select {
+			case <-done:
+				vm.Interrupt <- func() {
+					panic(errInterrupted)
+				}
+			case <-finished:
+			}
+		}()
+		defer func() {
+			if caught := recover(); caught != nil {
+				if caught != errInterrupted {
+					panic(caught)
+				}
+				err = fmt.Errorf("%w: %w", errInterrupted, ctx.Ctx().Err())
+			}
+		}()
+	}
+
 	value, err := vm.Run(this.Script)
 	if err != nil {
 		return err
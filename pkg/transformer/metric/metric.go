@@ -0,0 +1,169 @@
+package metric
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/vitrevance/api-exporter/pkg/metrics"
+	"github.com/vitrevance/api-exporter/pkg/transformer"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	metricNameRe = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRe  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+type metricTransformer struct {
+	// Metric name, required
+	Name string `yaml:"name"`
+
+	// Metric help text
+	Help string `yaml:"help"`
+
+	// gauge (default), counter or untyped
+	MetricType string `yaml:"metric_type"`
+
+	// Field path of the value inside each array element, ignored for numbers
+	Value string `yaml:"value"`
+
+	// Label names mapped to field paths inside each array element
+	Labels map[string]string `yaml:"labels"`
+
+	// Labels with fixed values
+	ConstLabels map[string]string `yaml:"const_labels"`
+
+	valueType  prometheus.ValueType
+	labelNames []string
+}
+
+func init() {
+	transformer.RegisterTransformerFactory("metric", transformer.TransformerFactoryFunc(func(value *yaml.Node) (transformer.Transformer, error) {
+		t := &metricTransformer{}
+		err := transformer.DecodeNode(value, t)
+		if err != nil {
+			return nil, err
+		}
+		return t, t.init()
+	}))
+}
+
+func (this *metricTransformer) init() error {
+	if !metricNameRe.MatchString(this.Name) {
+		return fmt.Errorf("invalid metric name %q", this.Name)
+	}
+	if this.Help == "" {
+		this.Help = this.Name
+	}
+	switch this.MetricType {
+	case "", "gauge":
+		this.valueType = prometheus.GaugeValue
+	case "counter":
+		this.valueType = prometheus.CounterValue
+	case "untyped":
+		this.valueType = prometheus.UntypedValue
+	default:
+		return fmt.Errorf("unknown metric_type %q, expecting gauge, counter or untyped", this.MetricType)
+	}
+
+	for name := range this.ConstLabels {
+		if _, ok := this.Labels[name]; ok {
+			return fmt.Errorf("label %s is defined both in labels and const_labels", name)
+		}
+		this.labelNames = append(this.labelNames, name)
+	}
+	for name := range this.Labels {
+		this.labelNames = append(this.labelNames, name)
+	}
+	for _, name := range this.labelNames {
+		if !labelNameRe.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("invalid label name %q", name)
+		}
+	}
+	slices.Sort(this.labelNames)
+	return nil
+}
+
+func (this *metricTransformer) Transform(ctx *transformer.TransformationContext) error {
+	var items []any
+	switch v := ctx.Object.(type) {
+	case []any:
+		items = v
+	case map[string]any:
+		items = []any{v}
+	default:
+		if len(this.Labels) > 0 {
+			return fmt.Errorf("metric %s: labels require an object or an array of objects", this.Name)
+		}
+		items = []any{v}
+	}
+
+	samples := make([]metrics.Sample, 0, len(items))
+	for i, item := range items {
+		raw := item
+		if _, ok := item.(map[string]any); ok {
+			var found bool
+			raw, found = transformer.Lookup(item, this.Value)
+			if !found {
+				return fmt.Errorf("metric %s: item [%d] has no value field %s", this.Name, i, this.Value)
+			}
+		}
+		value, err := toFloat(raw)
+		if err != nil {
+			return fmt.Errorf("metric %s: item [%d]: %w", this.Name, i, err)
+		}
+		labelValues := make([]string, len(this.labelNames))
+		for j, name := range this.labelNames {
+			if v, ok := this.ConstLabels[name]; ok {
+				labelValues[j] = v
+				continue
+			}
+			v, found := transformer.Lookup(item, this.Labels[name])
+			if !found {
+				return fmt.Errorf("metric %s: item [%d] has no label field %s", this.Name, i, this.Labels[name])
+			}
+			labelValues[j] = fmt.Sprint(v)
+		}
+		samples = append(samples, metrics.Sample{LabelValues: labelValues, Value: value})
+	}
+
+	owner := metrics.Owner{
+		Job:  metrics.JobFrom(ctx.Ctx()),
+		Step: metrics.StepFrom(ctx.Ctx()),
+	}
+	err := metrics.StoreFrom(ctx.Ctx()).Set(owner, metrics.RunFrom(ctx.Ctx()), this.Name, this.Help, this.valueType, this.labelNames, samples)
+	if err != nil {
+		return err
+	}
+	ctx.Result = ctx.Object
+	return nil
+}
+
+func toFloat(value any) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case json.Number:
+		return v.Float64()
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	default:
+		return 0, fmt.Errorf("cannot convert %T to a metric value", value)
+	}
+}
@@ -15,7 +15,7 @@ type valueTransformer struct {
 func init() {
 	transformer.RegisterTransformerFactory("parse", transformer.TransformerFactoryFunc(func(value *yaml.Node) (transformer.Transformer, error) {
 		t := &valueTransformer{}
-		err := value.Decode(t)
+		err := transformer.DecodeNode(value, t)
 		return t, err
 	}))
 }
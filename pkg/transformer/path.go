@@ -0,0 +1,33 @@
+package transformer
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Lookup resolves a dot-separated path like "items.0.name" in obj.
+// Path segments index maps by key and arrays by position, an empty path returns obj itself.
+func Lookup(obj any, path string) (any, bool) {
+	if path == "" {
+		return obj, true
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch v := obj.(type) {
+		case map[string]any:
+			var ok bool
+			obj, ok = v[key]
+			if !ok {
+				return nil, false
+			}
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			obj = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return obj, true
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 
+	"github.com/vitrevance/api-exporter/pkg/secret"
 	"github.com/vitrevance/api-exporter/pkg/transformer"
 	"gopkg.in/yaml.v3"
 )
@@ -16,7 +17,7 @@ type printTransformer struct {
 func init() {
 	transformer.RegisterTransformerFactory("print", transformer.TransformerFactoryFunc(func(value *yaml.Node) (transformer.Transformer, error) {
 		t := &printTransformer{}
-		err := value.Decode(t)
+		err := transformer.DecodeNode(value, t)
 		if t.Format == "" {
 			t.Format = "%v"
 		}
@@ -25,7 +26,7 @@ func init() {
 }
 
 func (this *printTransformer) Transform(ctx *transformer.TransformationContext) error {
-	str := fmt.Sprintf(this.Format, ctx.Object)
+	str := secret.Redact(fmt.Sprintf(this.Format, ctx.Object))
 	if this.Log {
 		log.Println(str)
 	}
@@ -17,7 +17,7 @@ type regexTransformer struct {
 func init() {
 	transformer.RegisterTransformerFactory("regex", transformer.TransformerFactoryFunc(func(value *yaml.Node) (transformer.Transformer, error) {
 		t := &regexTransformer{}
-		err := value.Decode(t)
+		err := transformer.DecodeNode(value, t)
 		if err != nil {
 			return nil, err
 		}
@@ -3,6 +3,7 @@ package sequence
 import (
 	"fmt"
 
+	"github.com/vitrevance/api-exporter/pkg/metrics"
 	"github.com/vitrevance/api-exporter/pkg/transformer"
 	"gopkg.in/yaml.v3"
 )
@@ -14,21 +15,26 @@ type sequenceTransformer struct {
 func init() {
 	transformer.RegisterTransformerFactory("sequence", transformer.TransformerFactoryFunc(func(value *yaml.Node) (transformer.Transformer, error) {
 		t := &sequenceTransformer{}
-		err := value.Decode(t)
+		err := transformer.DecodeNode(value, t)
 		return t, err
 	}))
 }
 
 func (this *sequenceTransformer) Transform(ctx *transformer.TransformationContext) error {
 	stepCtx := &transformer.TransformationContext{
+		Context:      ctx.Context,
 		Object:       ctx.Object,
 		Result:       ctx.Result,
 		Transformers: ctx.Transformers,
 	}
 	for i, step := range this.Steps {
+		if err := ctx.Ctx().Err(); err != nil {
+			return fmt.Errorf("step [%d] not started: %w", i, err)
+		}
 		if !step.KeepContext {
 			if i > 0 {
 				stepCtx = &transformer.TransformationContext{
+					Context:      ctx.Context,
 					Object:       stepCtx.Result,
 					Result:       make(map[string]any),
 					Transformers: ctx.Transformers,
@@ -38,9 +44,10 @@ func (this *sequenceTransformer) Transform(ctx *transformer.TransformationContex
 				stepCtx.Result = ctx.Result
 			}
 		}
+		stepCtx.Context = metrics.WithStep(ctx.Ctx(), i)
 		err := step.Transformer.Transform(stepCtx)
 		if err != nil {
-			return fmt.Errorf("step [%d] failed: %v", i, err)
+			return fmt.Errorf("step [%d] failed: %w", i, err)
 		}
 	}
 	ctx.Result = stepCtx.Result
@@ -0,0 +1,49 @@
+package transformer
+
+import "sync/atomic"
+
+// Stream is an object that yields records one by one instead of holding them in memory.
+// Next returns io.EOF after the last record. The consumer must Close the stream.
+type Stream interface {
+	Next() (any, error)
+	Close() error
+}
+
+// releasingStream calls release once all streams sharing it are closed
+type releasingStream struct {
+	Stream
+	open    *atomic.Int32
+	release func()
+	closed  bool
+}
+
+func (this *releasingStream) Close() error {
+	if !this.closed {
+		this.closed = true
+		if this.open.Add(-1) == 0 {
+			this.release()
+		}
+	}
+	return this.Stream.Close()
+}
+
+// releaseOnClose makes the streams in result, itself or its map values, call release once they are all closed.
+// It returns the result to use instead and false if there are no streams.
+func releaseOnClose(result any, release func()) (any, bool) {
+	open := &atomic.Int32{}
+	wrap := func(s Stream) Stream {
+		open.Add(1)
+		return &releasingStream{Stream: s, open: open, release: release}
+	}
+	switch r := result.(type) {
+	case Stream:
+		return wrap(r), true
+	case map[string]any:
+		for k, v := range r {
+			if s, ok := v.(Stream); ok {
+				r[k] = wrap(s)
+			}
+		}
+	}
+	return result, open.Load() > 0
+}
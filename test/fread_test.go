@@ -0,0 +1,34 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vitrevance/api-exporter/pkg/fread"
+)
+
+func TestReadConditional(t *testing.T) {
+	var full, notModified atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("jobs: []"))
+	}))
+	defer server.Close()
+
+	for range 3 {
+		data, err := fread.ReadFileOrHTTP(server.URL + "/config.yaml")
+		require.NoError(t, err)
+		require.Equal(t, "jobs: []", string(data))
+	}
+	require.Equal(t, int32(1), full.Load())
+	require.Equal(t, int32(2), notModified.Load())
+}
@@ -0,0 +1,828 @@
+package test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vitrevance/api-exporter/pkg/transformer"
+	"gopkg.in/yaml.v3"
+
+	_ "github.com/vitrevance/api-exporter/pkg/transformer/array"
+	httpt "github.com/vitrevance/api-exporter/pkg/transformer/http"
+)
+
+func TestHttpRetry(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	ts := make(map[string]transformer.TransformerConfig)
+	require.NoError(t, yaml.Unmarshal([]byte(`
+get:
+  type: http
+  retry:
+    max_attempts: 3
+    initial_backoff_ms: 1
+`), &ts))
+
+	ctx := &transformer.TransformationContext{
+		Object: map[string]any{"url": server.URL},
+		Result: make(map[string]any),
+	}
+	require.NoError(t, ts["get"].Transformer.Transform(ctx))
+	require.EqualValues(t, 3, calls.Load())
+	require.Equal(t, http.StatusOK, ctx.Result.(map[string]any)["status_code"])
+
+	// POST is not retried by default
+	calls.Store(0)
+	ctx = &transformer.TransformationContext{
+		Object: map[string]any{"url": server.URL, "method": http.MethodPost},
+		Result: make(map[string]any),
+	}
+	require.NoError(t, ts["get"].Transformer.Transform(ctx))
+	require.EqualValues(t, 1, calls.Load())
+	require.Equal(t, http.StatusServiceUnavailable, ctx.Result.(map[string]any)["status_code"])
+}
+
+func TestHttpRetryAfterLimits(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 2 {
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	ts := make(map[string]transformer.TransformerConfig)
+	require.NoError(t, yaml.Unmarshal([]byte(fmt.Sprintf(`
+clamped:
+  type: http
+  url: %[1]s
+  retry:
+    max_attempts: 2
+    max_backoff_ms: 10
+deadline:
+  type: http
+  url: %[1]s
+  timeout: 200ms
+  retry:
+    max_attempts: 2
+    initial_backoff_ms: 10000
+    max_backoff_ms: 10000
+`, server.URL)), &ts))
+
+	run := func(name string) int {
+		ctx := &transformer.TransformationContext{
+			Object: make(map[string]any),
+			Result: make(map[string]any),
+		}
+		require.NoError(t, ts[name].Transformer.Transform(ctx))
+		return ctx.Result.(map[string]any)["status_code"].(int)
+	}
+
+	// Retry-After is capped by max_backoff_ms
+	start := time.Now()
+	require.Equal(t, http.StatusOK, run("clamped"))
+	require.EqualValues(t, 2, calls.Load())
+	require.Less(t, time.Since(start), 5*time.Second)
+
+	// a retry past the deadline is not waited for, the last response is returned
+	calls.Store(0)
+	start = time.Now()
+	require.Equal(t, http.StatusServiceUnavailable, run("deadline"))
+	require.EqualValues(t, 1, calls.Load())
+	require.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestHttpPagination(t *testing.T) {
+	var otherHost string
+	var authorizations []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/link":
+			page := r.URL.Query().Get("p")
+			if page == "" {
+				w.Header().Set("Link", `</link?p=9>; rel="last"; title="first, then next", </link?p=2&ids=1,2>; rel="next"`)
+			}
+			fmt.Fprintf(w, "page%s%s", page, r.URL.Query().Get("ids"))
+		case "/hosts":
+			authorizations = append(authorizations, r.Header.Get("Authorization"))
+			if r.Host != otherHost {
+				w.Header().Set("Link", fmt.Sprintf(`<http://%s/hosts>; rel="next"`, otherHost))
+			}
+		case "/cursor":
+			switch r.URL.Query().Get("cursor") {
+			case "":
+				fmt.Fprint(w, `{"data": [1, 2], "meta": {"next": 1000000}}`)
+			case "1000000":
+				fmt.Fprint(w, `{"data": [3], "meta": {"next": null}}`)
+			}
+		case "/offset":
+			switch r.URL.Query().Get("offset") {
+			case "0":
+				fmt.Fprint(w, `{"items": [1, 2]}`)
+			case "2":
+				fmt.Fprint(w, `{"items": [3]}`)
+			}
+		}
+	}))
+	defer server.Close()
+	_, port, _ := strings.Cut(strings.TrimPrefix(server.URL, "http://"), ":")
+	otherHost = "localhost:" + port
+
+	ts := make(map[string]transformer.TransformerConfig)
+	require.NoError(t, yaml.Unmarshal([]byte(fmt.Sprintf(`
+link:
+  type: http
+  url: %[1]s/link
+  pagination:
+    strategy: link
+hosts:
+  type: http
+  url: %[1]s/hosts
+  headers:
+    Authorization: Bearer page-token
+  pagination:
+    strategy: link
+cursor:
+  type: http
+  url: %[1]s/cursor
+  pagination:
+    strategy: cursor
+    param: cursor
+    cursor_path: meta.next
+    items_path: data
+offset:
+  type: http
+  url: %[1]s/offset
+  pagination:
+    strategy: offset
+    param: offset
+    limit_param: limit
+    limit: 2
+    items_path: items
+`, server.URL)), &ts))
+
+	run := func(name string) any {
+		ctx := &transformer.TransformationContext{
+			Object: make(map[string]any),
+			Result: make(map[string]any),
+		}
+		require.NoError(t, ts[name].Transformer.Transform(ctx))
+		return ctx.Result
+	}
+
+	pages := run("link").([]any)
+	require.Len(t, pages, 2)
+	require.Equal(t, []byte("page"), pages[0].(map[string]any)["body"])
+	require.Equal(t, []byte("page21,2"), pages[1].(map[string]any)["body"])
+
+	// credentials are not sent to another host
+	require.Len(t, run("hosts"), 2)
+	require.Equal(t, []string{"Bearer page-token", ""}, authorizations)
+
+	require.Equal(t, []any{1.0, 2.0, 3.0}, run("cursor"))
+	require.Equal(t, []any{1.0, 2.0, 3.0}, run("offset"))
+
+	require.Error(t, yaml.Unmarshal([]byte(`
+bad:
+  type: http
+  pagination:
+    strategy: page
+`), &ts))
+}
+
+func TestHttpOAuth2(t *testing.T) {
+	var issued, valid atomic.Int32
+	// token requests are checked by the test, require must not be called from the handler goroutine
+	var mu sync.Mutex
+	var tokenRequests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			id, secret, _ := r.BasicAuth()
+			err := r.ParseForm()
+			mu.Lock()
+			tokenRequests = append(tokenRequests, fmt.Sprintf("%s:%s grant_type=%s scope=%s %v", id, secret, r.Form.Get("grant_type"), r.Form.Get("scope"), err))
+			mu.Unlock()
+			n := issued.Add(1)
+			valid.Store(n)
+			fmt.Fprintf(w, `{"access_token": "token%d", "token_type": "bearer", "expires_in": 3600}`, n)
+		case "/api":
+			if r.Header.Get("Authorization") != fmt.Sprintf("Bearer token%d", valid.Load()) {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}
+	}))
+	defer server.Close()
+
+	ts := make(map[string]transformer.TransformerConfig)
+	require.NoError(t, yaml.Unmarshal([]byte(fmt.Sprintf(`
+api:
+  type: http
+  url: %[1]s/api
+  oauth2:
+    token_url: %[1]s/token
+    client_id: client
+    client_secret: secret
+    scopes: [read, write]
+`, server.URL)), &ts))
+
+	run := func() int {
+		ctx := &transformer.TransformationContext{
+			Object: make(map[string]any),
+			Result: make(map[string]any),
+		}
+		require.NoError(t, ts["api"].Transformer.Transform(ctx))
+		return ctx.Result.(map[string]any)["status_code"].(int)
+	}
+
+	require.Equal(t, http.StatusOK, run())
+	require.Equal(t, http.StatusOK, run())
+	require.EqualValues(t, 1, issued.Load())
+
+	// token revoked by the server is refreshed on 401
+	valid.Store(0)
+	require.Equal(t, http.StatusOK, run())
+	require.EqualValues(t, 2, issued.Load())
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := "client:secret grant_type=client_credentials scope=read write <nil>"
+	require.Equal(t, []string{expected, expected}, tokenRequests)
+}
+
+func TestHttpTLSCA(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: server.Certificate().Raw,
+	}), 0o600))
+
+	ts := make(map[string]transformer.TransformerConfig)
+	require.NoError(t, yaml.Unmarshal([]byte(fmt.Sprintf(`
+trusted:
+  type: http
+  url: %[1]s
+  tls_ca_file: %[2]s
+  tls_min_version: "1.2"
+mismatch:
+  type: http
+  url: %[1]s
+  tls_ca_file: %[2]s
+  tls_server_name: other.test
+untrusted:
+  type: http
+  url: %[1]s
+`, server.URL, caFile)), &ts))
+
+	run := func(name string) error {
+		ctx := &transformer.TransformationContext{
+			Object: make(map[string]any),
+			Result: make(map[string]any),
+		}
+		return ts[name].Transformer.Transform(ctx)
+	}
+	require.NoError(t, run("trusted"))
+	require.Error(t, run("mismatch"))
+	require.Error(t, run("untrusted"))
+
+	require.Error(t, yaml.Unmarshal([]byte(`
+missing:
+  type: http
+  tls_ca_file: /nonexistent/ca.pem
+`), &ts))
+}
+
+func TestHttpTLSCAIPAddress(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "other.test"},
+		DNSNames:              []string{"other.test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	// the certificate is signed by the trusted CA but issued for another name than the dialed IP address
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	server.StartTLS()
+	defer server.Close()
+
+	ts := make(map[string]transformer.TransformerConfig)
+	require.NoError(t, yaml.Unmarshal([]byte(fmt.Sprintf(`
+address:
+  type: http
+  url: %[1]s
+  tls_ca: %[2]q
+named:
+  type: http
+  url: %[1]s
+  tls_ca: %[2]q
+  tls_server_name: other.test
+`, server.URL, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))), &ts))
+
+	run := func(name string) error {
+		ctx := &transformer.TransformationContext{
+			Object: make(map[string]any),
+			Result: make(map[string]any),
+		}
+		return ts[name].Transformer.Transform(ctx)
+	}
+	require.ErrorContains(t, run("address"), "cannot validate certificate for 127.0.0.1")
+	require.NoError(t, run("named"))
+}
+
+func TestHttpOverridesDoNotLeak(t *testing.T) {
+	headers := make(chan string, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Get("X-Override")
+	}))
+	defer server.Close()
+
+	ts := make(map[string]transformer.TransformerConfig)
+	require.NoError(t, yaml.Unmarshal([]byte(fmt.Sprintf(`
+get:
+  type: http
+  url: %s
+`, server.URL)), &ts))
+
+	for _, obj := range []map[string]any{
+		{"headers": map[string]any{"X-Override": "1"}},
+		{},
+	} {
+		ctx := &transformer.TransformationContext{
+			Object: obj,
+			Result: make(map[string]any),
+		}
+		require.NoError(t, ts["get"].Transformer.Transform(ctx))
+	}
+	require.Equal(t, "1", <-headers)
+	require.Equal(t, "", <-headers)
+
+	a, b := httpt.NewHttpTargetConfig(), httpt.NewHttpTargetConfig()
+	b.URL = "http://other.test"
+	clientA, err := a.HttpClient()
+	require.NoError(t, err)
+	clientB, err := b.HttpClient()
+	require.NoError(t, err)
+	require.Same(t, clientA, clientB)
+
+	b.TimeoutMillis = 1
+	clientB, err = b.HttpClient()
+	require.NoError(t, err)
+	require.NotSame(t, clientA, clientB)
+}
+
+func TestHttpChained(t *testing.T) {
+	upstream := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/second" {
+			upstream <- r.Header.Get("X-Upstream")
+		}
+		w.Header().Set("X-Upstream", r.URL.Path)
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	ts := make(map[string]transformer.TransformerConfig)
+	require.NoError(t, yaml.Unmarshal([]byte(fmt.Sprintf(`
+chained:
+  type: sequence
+  steps:
+    - type: http
+      url: %[1]s/first
+    - type: http
+      url: %[1]s/second
+      response_decoding: text
+`, server.URL)), &ts))
+
+	ctx := &transformer.TransformationContext{
+		Object: make(map[string]any),
+		Result: make(map[string]any),
+	}
+	require.NoError(t, ts["chained"].Transformer.Transform(ctx))
+	require.Equal(t, "ok", ctx.Result.(map[string]any)["body"])
+	// headers of the first response are not sent with the second request
+	require.Equal(t, "", <-upstream)
+}
+
+func TestHttpTemplates(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r
+	}))
+	defer server.Close()
+	t.Setenv("API_EXPORTER_TEST_TOKEN", "secret")
+
+	ts := make(map[string]transformer.TransformerConfig)
+	require.NoError(t, yaml.Unmarshal([]byte(fmt.Sprintf(`
+get:
+  type: http
+  url: '%s/items/{{ .id | pathEscape }}'
+  headers:
+    Authorization: 'Bearer {{ env "API_EXPORTER_TEST_TOKEN" }}'
+  query_params:
+    since: '{{ formatTime "2006-01-02" .since }}'
+`, server.URL)), &ts))
+
+	ctx := &transformer.TransformationContext{
+		Object: map[string]any{"id": "a/b", "since": 1700000000},
+		Result: make(map[string]any),
+	}
+	require.NoError(t, ts["get"].Transformer.Transform(ctx))
+	r := <-requests
+	require.Equal(t, "/items/a%2Fb", r.URL.RawPath)
+	require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+	require.Equal(t, "2023-11-14", r.URL.Query().Get("since"))
+
+	ctx = &transformer.TransformationContext{
+		Object: map[string]any{"since": 1700000000},
+		Result: make(map[string]any),
+	}
+	require.ErrorContains(t, ts["get"].Transformer.Transform(ctx), "id")
+
+	require.Error(t, yaml.Unmarshal([]byte(`
+bad:
+  type: http
+  url: '{{ .id'
+`), &ts))
+}
+
+func TestHttpEncoding(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/json":
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			fmt.Fprintf(w, `{"content_type": %q, "received": %s}`, r.Header.Get("Content-Type"), body)
+		case "/form":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write(body)
+		}
+	}))
+	defer server.Close()
+
+	ts := make(map[string]transformer.TransformerConfig)
+	require.NoError(t, yaml.Unmarshal([]byte(fmt.Sprintf(`
+json:
+  type: http
+  url: %[1]s/json
+  method: POST
+  request_encoding: json
+  response_decoding: auto
+form:
+  type: http
+  url: %[1]s/form
+  method: POST
+  request_encoding: form-urlencoded
+  response_decoding: auto
+  body:
+    a: 1
+    b: [x, y]
+raw:
+  type: http
+  url: %[1]s/json
+  method: POST
+  body: '{"raw": true}'
+`, server.URL)), &ts))
+
+	run := func(name string, obj map[string]any) map[string]any {
+		ctx := &transformer.TransformationContext{
+			Object: obj,
+			Result: make(map[string]any),
+		}
+		require.NoError(t, ts[name].Transformer.Transform(ctx))
+		return ctx.Result.(map[string]any)
+	}
+
+	res := run("json", map[string]any{"body": []any{map[string]any{"id": 1.0}}})
+	require.Equal(t, map[string]any{
+		"content_type": "application/json",
+		"received":     []any{map[string]any{"id": 1.0}},
+	}, res["body"])
+	require.IsType(t, []byte{}, res["raw_body"])
+
+	res = run("form", make(map[string]any))
+	require.Equal(t, "a=1&b=x&b=y", res["body"])
+
+	res = run("raw", make(map[string]any))
+	require.IsType(t, []byte{}, res["body"])
+	require.Nil(t, res["raw_body"])
+}
+
+func TestHttpExpectStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code, _ := strconv.Atoi(r.URL.Query().Get("code"))
+		w.WriteHeader(code)
+		fmt.Fprint(w, "details")
+	}))
+	defer server.Close()
+
+	ts := make(map[string]transformer.TransformerConfig)
+	require.NoError(t, yaml.Unmarshal([]byte(fmt.Sprintf(`
+post:
+  type: http
+  url: %s
+  expect_status: [2xx, 404, 300-302]
+`, server.URL)), &ts))
+
+	run := func(code int) error {
+		ctx := &transformer.TransformationContext{
+			Object: map[string]any{"query_params": map[string]any{"code": strconv.Itoa(code)}},
+			Result: make(map[string]any),
+		}
+		return ts["post"].Transformer.Transform(ctx)
+	}
+	require.NoError(t, run(http.StatusCreated))
+	require.NoError(t, run(http.StatusNotFound))
+	require.NoError(t, run(http.StatusFound))
+	err := run(http.StatusInternalServerError)
+	require.ErrorContains(t, err, "500")
+	require.ErrorContains(t, err, "details")
+
+	require.Error(t, yaml.Unmarshal([]byte(`
+bad:
+  type: http
+  expect_status: [6xx]
+`), &ts))
+}
+
+func TestHttpStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/json":
+			fmt.Fprint(w, `{"meta": {"total": 3}, "data": {"items": [{"id": 1}, {"id": 2}, {"id": 3}]}}`)
+		case "/ndjson":
+			fmt.Fprint(w, "{\"id\": 1}\n\n{\"id\": 2}\n")
+		case "/slow":
+			// the rest of the body arrives after the http step returned
+			fmt.Fprint(w, "{\"id\": 1}\n")
+			w.(http.Flusher).Flush()
+			delay, _ := time.ParseDuration(r.URL.Query().Get("delay"))
+			time.Sleep(delay)
+			fmt.Fprint(w, "{\"id\": 2}\n")
+		}
+	}))
+	defer server.Close()
+
+	ts := make(map[string]transformer.TransformerConfig)
+	require.NoError(t, yaml.Unmarshal([]byte(fmt.Sprintf(`
+json:
+  type: sequence
+  steps:
+    - type: http
+      url: %[1]s/json
+      stream: json
+      stream_path: data.items
+    - type: field
+      source: body
+    - type: array
+      map:
+        type: field
+        source: id
+ndjson:
+  type: sequence
+  steps:
+    - type: http
+      url: %[1]s/ndjson
+      stream: ndjson
+    - type: field
+      source: body
+    - type: array
+      map:
+        type: field
+        source: id
+limited:
+  type: http
+  url: %[1]s/json
+  max_response_bytes: 16
+slow:
+  type: sequence
+  steps:
+    - type: http
+      url: %[1]s/slow?delay=100ms
+      stream: ndjson
+      timeout: 5s
+    - type: field
+      source: body
+    - type: array
+      map:
+        type: field
+        source: id
+too_slow:
+  type: sequence
+  steps:
+    - type: http
+      url: %[1]s/slow?delay=1s
+      stream: ndjson
+      timeout: 200ms
+    - type: field
+      source: body
+    - type: array
+      map:
+        type: field
+        source: id
+`, server.URL)), &ts))
+
+	run := func(name string) (any, error) {
+		ctx := &transformer.TransformationContext{
+			Object: make(map[string]any),
+			Result: make(map[string]any),
+		}
+		err := ts[name].Transformer.Transform(ctx)
+		return ctx.Result, err
+	}
+
+	res, err := run("json")
+	require.NoError(t, err)
+	require.Equal(t, []any{1.0, 2.0, 3.0}, res)
+
+	res, err = run("ndjson")
+	require.NoError(t, err)
+	require.Equal(t, []any{1.0, 2.0}, res)
+
+	_, err = run("limited")
+	require.ErrorContains(t, err, "max_response_bytes")
+
+	// a step timeout keeps the stream readable by later steps but still limits reading it
+	res, err = run("slow")
+	require.NoError(t, err)
+	require.Equal(t, []any{1.0, 2.0}, res)
+
+	start := time.Now()
+	_, err = run("too_slow")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), time.Second)
+}
+
+func TestHttpCassette(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "hello %s", r.URL.Query().Get("name"))
+	}))
+	dir := t.TempDir()
+	defer httpt.SetCassette("", httpt.CassettePassthrough)
+
+	ts := make(map[string]transformer.TransformerConfig)
+	require.NoError(t, yaml.Unmarshal([]byte(fmt.Sprintf(`
+get:
+  type: http
+  url: %s
+  response_decoding: text
+  headers:
+    Authorization: Bearer secret
+`, server.URL)), &ts))
+
+	run := func(name string) (any, error) {
+		ctx := &transformer.TransformationContext{
+			Object: map[string]any{"query_params": map[string]any{"name": name}},
+			Result: make(map[string]any),
+		}
+		err := ts["get"].Transformer.Transform(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return ctx.Result.(map[string]any)["body"], nil
+	}
+
+	require.NoError(t, httpt.SetCassette(dir, httpt.CassetteRecord))
+	body, err := run("world")
+	require.NoError(t, err)
+	require.Equal(t, "hello world", body)
+	server.Close()
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "secret")
+
+	require.NoError(t, httpt.SetCassette(dir, httpt.CassetteReplay))
+	body, err = run("world")
+	require.NoError(t, err)
+	require.Equal(t, "hello world", body)
+
+	_, err = run("nobody")
+	require.ErrorContains(t, err, "no recorded interaction")
+}
+
+func TestHttpCassetteRedactsBodies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"user": %q, "access_token": "issued-token"}`, r.FormValue("user"))
+	}))
+	dir := t.TempDir()
+	defer httpt.SetCassette("", httpt.CassettePassthrough)
+
+	ts := make(map[string]transformer.TransformerConfig)
+	require.NoError(t, yaml.Unmarshal([]byte(fmt.Sprintf(`
+login:
+  type: http
+  method: POST
+  url: %s
+  request_encoding: form-urlencoded
+  response_decoding: json
+`, server.URL)), &ts))
+
+	run := func(password string) (any, error) {
+		ctx := &transformer.TransformationContext{
+			Object: map[string]any{"body": map[string]any{"user": "bob", "password": password}},
+			Result: make(map[string]any),
+		}
+		if err := ts["login"].Transformer.Transform(ctx); err != nil {
+			return nil, err
+		}
+		return ctx.Result.(map[string]any)["body"], nil
+	}
+
+	require.NoError(t, httpt.SetCassette(dir, httpt.CassetteRecord))
+	_, err := run("hunter22")
+	require.NoError(t, err)
+	server.Close()
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "hunter22")
+	require.NotContains(t, string(data), "issued-token")
+	require.Contains(t, string(data), "bob")
+
+	// credentials are not part of the key, so replays do not need the recorded ones
+	require.NoError(t, httpt.SetCassette(dir, httpt.CassetteReplay))
+	body, err := run("other-password")
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{"user": "bob", "access_token": "REDACTED"}, body)
+}
+
+func TestHttpCassetteResponseLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, strings.Repeat("x", 1024))
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	defer httpt.SetCassette("", httpt.CassettePassthrough)
+
+	ts := make(map[string]transformer.TransformerConfig)
+	require.NoError(t, yaml.Unmarshal([]byte(fmt.Sprintf(`
+limited:
+  type: http
+  url: %s
+  max_response_bytes: 16
+`, server.URL)), &ts))
+
+	// recording reads the whole body, so it is limited like reading it without a cassette
+	require.NoError(t, httpt.SetCassette(dir, httpt.CassetteRecord))
+	err := ts["limited"].Transformer.Transform(&transformer.TransformationContext{
+		Object: make(map[string]any),
+		Result: make(map[string]any),
+	})
+	require.ErrorContains(t, err, "max_response_bytes of 16 bytes")
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	require.NoError(t, err)
+	require.Empty(t, files)
+}
@@ -0,0 +1,115 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vitrevance/api-exporter/pkg/runner"
+	"github.com/vitrevance/api-exporter/pkg/transformer"
+	"gopkg.in/yaml.v3"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+}
+
+func jobNames(cfg *runner.Config) []string {
+	var names []string
+	for _, job := range cfg.Jobs {
+		names = append(names, job.JobName)
+	}
+	return names
+}
+
+func TestLoadConfigInclude(t *testing.T) {
+	remote := t.TempDir()
+	writeFiles(t, remote, map[string]string{
+		"remote.yaml": "include: [shared.yaml]\njobs:\n  - job_name: remote\n    steps:\n      - type: shared_field\n",
+		"shared.yaml": "transformers:\n  shared_field:\n    type: field\n    source: name\n",
+	})
+	server := httptest.NewServer(http.FileServer(http.Dir(remote)))
+	defer server.Close()
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"config.yaml":      "include: [teams/*.yaml, " + server.URL + "/remote.yaml]\njobs:\n  - job_name: root\n    steps:\n      - type: shared_field\n",
+		"teams/a.yaml":     "jobs:\n  - job_name: a\n    steps:\n      - type: shared_field\n",
+		"teams/b.yaml":     "jobs:\n  - job_name: b\n    steps:\n      - type: shared_field\n",
+		"teams/notes.txt":  "not a config",
+		"dup/config.yaml":  "include: [other.yaml]\njobs:\n  - job_name: a\n",
+		"dup/other.yaml":   "jobs:\n  - job_name: b\n  - job_name: a\n",
+		"dir/a.yaml":       "jobs:\n  - job_name: a\n",
+		"dir/b.yml":        "jobs:\n  - job_name: b\n",
+		"dir/sub/c.yaml":   "jobs:\n  - job_name: c\n",
+		"dir/readme.md":    "not a config",
+		"strict/a.yaml":    "jobs:\n  - job_name: a\n    unknown: rejected\n",
+		"strict/main.yaml": "strict: false\ninclude: [a.yaml, b.yaml]\n",
+		"strict/b.yaml":    "strict: false\njobs:\n  - job_name: b\n    unknown: ignored\n",
+	})
+
+	files, err := runner.ReadConfig(filepath.Join(dir, "config.yaml"))
+	require.NoError(t, err)
+	require.Len(t, files.Paths(), 5)
+	require.Empty(t, runner.ValidateFiles(files))
+	cfg, err := files.Decode()
+	require.NoError(t, err)
+	require.Equal(t, []string{"root", "a", "b", "remote"}, jobNames(cfg))
+	require.Contains(t, cfg.Transformers, "shared_field")
+
+	_, err = runner.LoadConfig(filepath.Join(dir, "dup", "config.yaml"))
+	require.EqualError(t, err, filepath.Join(dir, "dup", "other.yaml")+`: line 3: duplicate job_name "a", first defined at `+filepath.Join(dir, "dup", "config.yaml")+":3")
+	files, err = runner.ReadConfig(filepath.Join(dir, "dup", "config.yaml"))
+	require.NoError(t, err)
+	errs := runner.ValidateFiles(files)
+	require.Len(t, errs, 1)
+	require.Equal(t, filepath.Join(dir, "dup", "other.yaml"), errs[0].File)
+
+	cfg, err = runner.LoadConfig(filepath.Join(dir, "dir"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, jobNames(cfg))
+
+	// strict: false applies to its own file only
+	_, err = runner.LoadConfig(filepath.Join(dir, "strict", "main.yaml"))
+	require.EqualError(t, err, filepath.Join(dir, "strict", "a.yaml")+`: line 3, column 5: unknown field "unknown"`)
+	require.NoError(t, os.Remove(filepath.Join(dir, "strict", "a.yaml")))
+	_, err = runner.LoadConfig(filepath.Join(dir, "strict", "main.yaml"))
+	require.ErrorContains(t, err, "a.yaml")
+	cfg, err = runner.LoadConfig(filepath.Join(dir, "strict", "b.yaml"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"b"}, jobNames(cfg))
+}
+
+func TestConfigDecodeIsolation(t *testing.T) {
+	const good = `
+transformers:
+  named:
+    type: field
+    source: name
+jobs:
+  - job_name: a
+    steps:
+      - type: named
+`
+	cfg := &runner.Config{}
+	require.NoError(t, yaml.Unmarshal([]byte(good), cfg))
+
+	// names of a decoded config are not transformer types outside of it
+	var tc transformer.TransformerConfig
+	require.ErrorContains(t, yaml.Unmarshal([]byte("type: named"), &tc), "unknown transformer type named")
+
+	// a failed config leaves nothing behind for the next one
+	require.Error(t, yaml.Unmarshal([]byte(good+"      - type: missing\n"), &runner.Config{}))
+	again := &runner.Config{}
+	require.NoError(t, yaml.Unmarshal([]byte(good), again))
+	require.Len(t, again.Jobs, 1)
+
+	require.ErrorContains(t, yaml.Unmarshal([]byte("transformers:\n  http:\n    type: value\n"), &runner.Config{}), "conflicts with a built-in transformer type")
+}
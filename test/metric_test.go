@@ -0,0 +1,213 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"github.com/vitrevance/api-exporter/pkg/metrics"
+	"github.com/vitrevance/api-exporter/pkg/runner"
+	"github.com/vitrevance/api-exporter/pkg/transformer"
+	"gopkg.in/yaml.v3"
+
+	_ "github.com/vitrevance/api-exporter/pkg/transformer/http"
+	_ "github.com/vitrevance/api-exporter/pkg/transformer/metric"
+)
+
+func TestMetric(t *testing.T) {
+	ts := make(map[string]transformer.TransformerConfig)
+	require.NoError(t, yaml.Unmarshal([]byte(`
+stars:
+  type: metric
+  name: test_repo_stars
+  help: Stars of a repository.
+  value: stars
+  labels:
+    repo: name
+    owner: owner.login
+  const_labels:
+    source: github
+`), &ts))
+
+	run := func(items ...any) {
+		ctx := &transformer.TransformationContext{
+			Context: metrics.WithJob(context.Background(), "stars"),
+			Object:  items,
+			Result:  make(map[string]any),
+		}
+		require.NoError(t, ts["stars"].Transformer.Transform(ctx))
+	}
+
+	run(
+		map[string]any{"name": "a", "stars": 10, "owner": map[string]any{"login": "x"}},
+		map[string]any{"name": "b", "stars": "2.5", "owner": map[string]any{"login": "y"}},
+	)
+	require.NoError(t, testutil.CollectAndCompare(metrics.DefaultStore, strings.NewReader(`
+# HELP test_repo_stars Stars of a repository.
+# TYPE test_repo_stars gauge
+test_repo_stars{owner="x",repo="a",source="github"} 10
+test_repo_stars{owner="y",repo="b",source="github"} 2.5
+`), "test_repo_stars"))
+
+	// series of "a" is no longer produced and must be dropped
+	run(map[string]any{"name": "b", "stars": 3, "owner": map[string]any{"login": "y"}})
+	require.NoError(t, testutil.CollectAndCompare(metrics.DefaultStore, strings.NewReader(`
+# HELP test_repo_stars Stars of a repository.
+# TYPE test_repo_stars gauge
+test_repo_stars{owner="y",repo="b",source="github"} 3
+`), "test_repo_stars"))
+
+	metrics.DefaultStore.Forget("stars")
+	require.Equal(t, 0, testutil.CollectAndCount(metrics.DefaultStore, "test_repo_stars"))
+}
+
+func TestMetricOwners(t *testing.T) {
+	cfg := &runner.Config{}
+	require.NoError(t, yaml.Unmarshal([]byte(`
+jobs:
+  - job_name: owners
+    steps:
+      - type: field
+        source: first
+        map:
+          type: metric
+          name: test_owner_items
+          value: v
+          labels:
+            name: name
+      - type: field
+        keep_ctx: true
+        source: second
+        map:
+          type: array
+          map:
+            type: metric
+            name: test_owner_items
+            value: v
+            labels:
+              name: name
+`), cfg))
+	job, ok := cfg.Job("owners")
+	require.True(t, ok)
+	defer metrics.ForgetJob("owners")
+
+	run := func(second ...any) {
+		require.NoError(t, cfg.RunJob(context.Background(), job, map[string]any{
+			"first":  []any{map[string]any{"name": "a", "v": 1}},
+			"second": second,
+		}))
+	}
+
+	// steps with equal const labels and every element of an array keep their series
+	run(map[string]any{"name": "b", "v": 2}, map[string]any{"name": "c", "v": 3})
+	require.NoError(t, testutil.CollectAndCompare(metrics.DefaultStore, strings.NewReader(`
+# HELP test_owner_items test_owner_items
+# TYPE test_owner_items gauge
+test_owner_items{name="a"} 1
+test_owner_items{name="b"} 2
+test_owner_items{name="c"} 3
+`), "test_owner_items"))
+
+	// elements of the previous run are dropped
+	run(map[string]any{"name": "c", "v": 4})
+	require.NoError(t, testutil.CollectAndCompare(metrics.DefaultStore, strings.NewReader(`
+# HELP test_owner_items test_owner_items
+# TYPE test_owner_items gauge
+test_owner_items{name="a"} 1
+test_owner_items{name="c"} 4
+`), "test_owner_items"))
+}
+
+func TestMetricStoreInvalid(t *testing.T) {
+	store := metrics.NewStore()
+	owner := metrics.Owner{Job: "invalid"}
+	require.ErrorContains(t, store.Set(owner, 0, "api_exporter_job_runs_total", "clash", prometheus.GaugeValue, nil, []metrics.Sample{{Value: 1}}), "reserved")
+
+	require.NoError(t, store.Set(owner, 0, "test_invalid", "help", prometheus.GaugeValue, []string{"name"}, []metrics.Sample{
+		{LabelValues: []string{"ok"}, Value: 1},
+		{LabelValues: []string{"\xff"}, Value: 2},
+	}))
+	// the series with a label value that is not utf-8 is skipped instead of panicking
+	require.Equal(t, 1, testutil.CollectAndCount(store, "test_invalid"))
+}
+
+// histogramCount returns the number of observations of the histogram series with labels in the registry
+func histogramCount(t *testing.T, name string, labels map[string]string) uint64 {
+	families, err := metrics.Registry.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	next:
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if v, ok := labels[label.GetName()]; ok && v != label.GetValue() {
+					continue next
+				}
+			}
+			return m.GetHistogram().GetSampleCount()
+		}
+	}
+	return 0
+}
+
+func TestRunJobMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"name": "x"}`)
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	host := u.Host
+
+	cfg := &runner.Config{}
+	require.NoError(t, yaml.Unmarshal([]byte(fmt.Sprintf(`
+jobs:
+  - job_name: metrics_demo
+    steps:
+      - type: http
+        url: %[1]s/up
+      - type: http
+        keep_ctx: true
+        url: %[1]s/down
+        expect_status: [2xx]
+      - type: field
+        source: name
+`, server.URL)), cfg))
+	job, ok := cfg.Job("metrics_demo")
+	require.True(t, ok)
+	defer metrics.ForgetJob("metrics_demo")
+
+	require.Error(t, cfg.RunJob(context.Background(), job, nil))
+	require.Error(t, cfg.RunJob(context.Background(), job, nil))
+
+	require.Equal(t, 2.0, testutil.ToFloat64(metrics.JobRuns.WithLabelValues("metrics_demo", "failure")))
+	require.Equal(t, 0.0, testutil.ToFloat64(metrics.JobRuns.WithLabelValues("metrics_demo", "success")))
+	require.EqualValues(t, 2, histogramCount(t, "api_exporter_job_duration_seconds", map[string]string{"job_name": "metrics_demo"}))
+
+	// the failing step is the last one run
+	step := func(index string) map[string]string {
+		return map[string]string{"job_name": "metrics_demo", "step": index, "type": "http"}
+	}
+	require.EqualValues(t, 2, histogramCount(t, "api_exporter_step_duration_seconds", step("0")))
+	require.EqualValues(t, 2, histogramCount(t, "api_exporter_step_duration_seconds", step("1")))
+	require.EqualValues(t, 0, histogramCount(t, "api_exporter_step_duration_seconds", map[string]string{"job_name": "metrics_demo", "step": "2"}))
+	require.Equal(t, 0.0, testutil.ToFloat64(metrics.StepFailures.WithLabelValues("metrics_demo", "0", "http")))
+	require.Equal(t, 2.0, testutil.ToFloat64(metrics.StepFailures.WithLabelValues("metrics_demo", "1", "http")))
+
+	require.Equal(t, 2.0, testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("GET", host, "200")))
+	require.Equal(t, 2.0, testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("GET", host, "503")))
+	require.EqualValues(t, 4, histogramCount(t, "api_exporter_http_request_duration_seconds", map[string]string{"method": "GET", "host": host}))
+}
@@ -0,0 +1,55 @@
+package test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vitrevance/api-exporter/pkg/runner"
+	"gopkg.in/yaml.v3"
+)
+
+func TestProbe(t *testing.T) {
+	cfg := &runner.Config{}
+	require.NoError(t, yaml.Unmarshal([]byte(`
+jobs:
+  - job_name: echo
+    probe: true
+    steps:
+      - type: field
+        source: n
+      - type: metric
+        name: probe_test_value
+        help: Value of n.
+`), cfg))
+
+	server := httptest.NewServer(runner.ProbeHandler(func() *runner.Config { return cfg }))
+	defer server.Close()
+
+	get := func(query string) (int, string) {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"?"+query, nil)
+		require.NoError(t, err)
+		req.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", "5")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	code, body := get("job=echo&n=42")
+	require.Equal(t, http.StatusOK, code)
+	require.Contains(t, body, "probe_test_value 42\n")
+	require.Contains(t, body, "probe_success 1\n")
+
+	code, body = get("job=echo")
+	require.Equal(t, http.StatusOK, code)
+	require.NotContains(t, body, "probe_test_value")
+	require.Contains(t, body, "probe_success 0\n")
+
+	code, _ = get("job=missing")
+	require.Equal(t, http.StatusNotFound, code)
+}
@@ -0,0 +1,172 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"github.com/vitrevance/api-exporter/pkg/metrics"
+	"github.com/vitrevance/api-exporter/pkg/runner"
+)
+
+// nextConfig returns the next config sent by a reloader or nil if none is sent within wait
+func nextConfig(ch <-chan *runner.Config, wait time.Duration) *runner.Config {
+	select {
+	case cfg := <-ch:
+		return cfg
+	case <-time.After(wait):
+		return nil
+	}
+}
+
+// reloadStatus returns the status code and body served on /status
+func reloadStatus(t *testing.T, status http.Handler) (int, map[string]any) {
+	w := httptest.NewRecorder()
+	status.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	return w.Code, body
+}
+
+func writeJobs(t *testing.T, path string, names ...string) {
+	data := "jobs:\n"
+	for _, name := range names {
+		data += fmt.Sprintf("  - job_name: %s\n    interval: 1h\n    steps: []\n", name)
+	}
+	require.NoError(t, os.WriteFile(path, []byte(data), 0o644))
+}
+
+func TestReloader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeJobs(t, path, "a")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reloader := runner.NewReloader(path, 0)
+	updates := reloader.Start(ctx)
+
+	cfg := nextConfig(updates, 5*time.Second)
+	require.NotNil(t, cfg)
+	require.Equal(t, []string{"a"}, jobNames(cfg))
+
+	// writes are debounced into a single reload
+	writeJobs(t, path, "a", "b")
+	writeJobs(t, path, "a", "b", "c")
+	cfg = nextConfig(updates, 5*time.Second)
+	require.NotNil(t, cfg)
+	require.Equal(t, []string{"a", "b", "c"}, jobNames(cfg))
+	require.Nil(t, nextConfig(updates, time.Second))
+
+	// a broken config is reported and not sent
+	require.NoError(t, os.WriteFile(path, []byte("jobs: [\n"), 0o644))
+	require.Nil(t, nextConfig(updates, 2*time.Second))
+	code, status := reloadStatus(t, reloader.Status)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, false, status["last_reload_success"])
+
+	// the failed config is retried on SIGHUP, e.g. once a referenced environment variable is set
+	writeJobs(t, path, "${env:API_EXPORTER_TEST_JOB}")
+	require.Nil(t, nextConfig(updates, 2*time.Second))
+	t.Setenv("API_EXPORTER_TEST_JOB", "d")
+	reloader.Reload("SIGHUP")
+	cfg = nextConfig(updates, 5*time.Second)
+	require.NotNil(t, cfg)
+	require.Equal(t, []string{"d"}, jobNames(cfg))
+
+	// SIGHUP reloads an unchanged config too
+	reloader.Reload("SIGHUP")
+	cfg = nextConfig(updates, 5*time.Second)
+	require.NotNil(t, cfg)
+	require.Equal(t, []string{"d"}, jobNames(cfg))
+
+	code, status = reloadStatus(t, reloader.Status)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, true, status["last_reload_success"])
+}
+
+func TestReloaderSecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	secretPath := filepath.Join(dir, "job-name")
+	require.NoError(t, os.WriteFile(secretPath, []byte("first"), 0o600))
+	writeJobs(t, path, "${file:"+secretPath+"}")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := runner.NewReloader(path, 100*time.Millisecond).Start(ctx)
+
+	cfg := nextConfig(updates, 5*time.Second)
+	require.NotNil(t, cfg)
+	require.Equal(t, []string{"first"}, jobNames(cfg))
+	require.Nil(t, nextConfig(updates, 500*time.Millisecond))
+
+	// a rotated secret file changes the config although no config file did
+	require.NoError(t, os.WriteFile(secretPath, []byte("second"), 0o600))
+	cfg = nextConfig(updates, 5*time.Second)
+	require.NotNil(t, cfg)
+	require.Equal(t, []string{"second"}, jobNames(cfg))
+}
+
+func TestReloadFailureKeepsJobs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+jobs:
+  - job_name: ticking
+    interval: 50ms
+    steps:
+      - type: value
+        value: 1
+`), 0o644))
+
+	counter := &runCounter{runs: make(map[string]int), failures: make(map[string]int)}
+	ctx, cancel := context.WithCancel(runner.WithObserver(context.Background(), counter))
+	defer cancel()
+	scheduler := runner.NewScheduler(ctx, time.Second)
+	defer scheduler.Shutdown(time.Second)
+	reloader := runner.NewReloader(path, 0)
+	updates := reloader.Start(ctx)
+	go func() {
+		for {
+			select {
+			case cfg := <-updates:
+				scheduler.Apply(cfg)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	require.Eventually(t, func() bool {
+		return counter.get(counter.runs)["ticking"] > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	_, status := reloadStatus(t, reloader.Status)
+	hash := status["config_hash"]
+
+	failures := testutil.ToFloat64(metrics.ConfigReloads.WithLabelValues("failure"))
+	require.NoError(t, os.WriteFile(path, []byte("jobs:\n  - job_name: ticking\n    steps: [\n"), 0o644))
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(metrics.ConfigReloads.WithLabelValues("failure")) == failures+1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, 0.0, testutil.ToFloat64(metrics.ConfigLastReloadSuccessful))
+
+	// the previous config is still running and reported
+	code, status := reloadStatus(t, reloader.Status)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, false, status["last_reload_success"])
+	require.NotEmpty(t, status["last_reload_error"])
+	require.Equal(t, hash, status["config_hash"])
+	require.EqualValues(t, 1, status["jobs"])
+
+	runs := counter.get(counter.runs)["ticking"]
+	require.Eventually(t, func() bool {
+		return counter.get(counter.runs)["ticking"] > runs+1
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,115 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vitrevance/api-exporter/pkg/runner"
+	"github.com/vitrevance/api-exporter/pkg/transformer"
+	"gopkg.in/yaml.v3"
+)
+
+func TestJobSchedule(t *testing.T) {
+	var job runner.JobConfig
+	require.NoError(t, yaml.Unmarshal([]byte(`
+job_name: nightly
+schedule: "15 2 * * *"
+timezone: Europe/Berlin
+steps: []
+`), &job))
+	require.False(t, job.ShouldRunOnStart())
+
+	loc, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	next, ok := job.NextRun(time.Date(2025, 1, 10, 3, 0, 0, 0, loc))
+	require.True(t, ok)
+	require.True(t, next.Equal(time.Date(2025, 1, 11, 2, 15, 0, 0, loc)))
+
+	var seconds runner.JobConfig
+	require.NoError(t, yaml.Unmarshal([]byte(`
+job_name: seconds
+schedule: "30 */5 * * * *"
+steps: []
+`), &seconds))
+	next, ok = seconds.NextRun(time.Date(2025, 1, 10, 3, 1, 0, 0, time.UTC))
+	require.True(t, ok)
+	require.True(t, next.Equal(time.Date(2025, 1, 10, 3, 5, 30, 0, time.UTC)))
+}
+
+func TestJobInterval(t *testing.T) {
+	var job runner.JobConfig
+	require.NoError(t, yaml.Unmarshal([]byte(`
+job_name: periodic
+interval: 1m
+jitter: 10s
+steps: []
+`), &job))
+	require.True(t, job.ShouldRunOnStart())
+
+	last := time.Date(2025, 1, 10, 3, 0, 0, 0, time.UTC)
+	next, ok := job.NextRun(last)
+	require.True(t, ok)
+	require.False(t, next.Before(last.Add(time.Minute)))
+	require.True(t, next.Before(last.Add(time.Minute+10*time.Second)))
+
+	var once runner.JobConfig
+	require.NoError(t, yaml.Unmarshal([]byte(`
+job_name: once
+steps: []
+`), &once))
+	_, ok = once.NextRun(last)
+	require.False(t, ok)
+}
+
+func TestJobScheduleErrors(t *testing.T) {
+	for _, cfg := range []string{
+		"job_name: bad\nschedule: '61 * * * *'",
+		"job_name: both\nschedule: '* * * * *'\ninterval: 1m",
+		"job_name: tz\nschedule: '* * * * *'\ntimezone: Mars/Olympus",
+		"job_name: jitter\ninterval: 1m\njitter: -1s",
+	} {
+		var job runner.JobConfig
+		require.Error(t, yaml.Unmarshal([]byte(cfg), &job), cfg)
+	}
+}
+
+type recordingObserver struct {
+	steps []string
+}
+
+func (this *recordingObserver) BeforeStep(job string, index int, step transformer.TransformerConfig, ctx *transformer.TransformationContext) {
+	this.steps = append(this.steps, fmt.Sprintf("before %s %d %s %v", job, index, step.Type, ctx.Object))
+}
+
+func (this *recordingObserver) AfterStep(job string, index int, step transformer.TransformerConfig, ctx *transformer.TransformationContext, err error) {
+	this.steps = append(this.steps, fmt.Sprintf("after %s %d %s %v %v", job, index, step.Type, ctx.Result, err))
+}
+
+func TestRunJobObserver(t *testing.T) {
+	cfg := &runner.Config{}
+	require.NoError(t, yaml.Unmarshal([]byte(`
+jobs:
+  - job_name: demo
+    steps:
+      - type: field
+        source: name
+      - type: field
+        source: missing
+`), cfg))
+	job, ok := cfg.Job("demo")
+	require.True(t, ok)
+
+	observer := &recordingObserver{}
+	ctx := runner.WithObserver(context.Background(), observer)
+	err := cfg.RunJob(ctx, job, map[string]any{"name": "world"})
+	require.Error(t, err)
+	require.Equal(t, []string{
+		"before demo 0 field map[name:world]",
+		"after demo 0 field world <nil>",
+		"before demo 1 field world",
+		"after demo 1 field map[] invalid json object",
+	}, observer.steps)
+}
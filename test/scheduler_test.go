@@ -0,0 +1,342 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vitrevance/api-exporter/pkg/metrics"
+	"github.com/vitrevance/api-exporter/pkg/runner"
+	"github.com/vitrevance/api-exporter/pkg/transformer"
+	"gopkg.in/yaml.v3"
+)
+
+// runCounter counts started runs and failed steps per job, jobs run concurrently
+type runCounter struct {
+	mu       sync.Mutex
+	runs     map[string]int
+	failures map[string]int
+}
+
+func (this *runCounter) BeforeStep(job string, index int, step transformer.TransformerConfig, ctx *transformer.TransformationContext) {
+	if index == 0 {
+		this.mu.Lock()
+		defer this.mu.Unlock()
+		this.runs[job]++
+	}
+}
+
+func (this *runCounter) AfterStep(job string, index int, step transformer.TransformerConfig, ctx *transformer.TransformationContext, err error) {
+	if err != nil {
+		this.mu.Lock()
+		defer this.mu.Unlock()
+		this.failures[job]++
+	}
+}
+
+func (this *runCounter) get(counts map[string]int) map[string]int {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	result := make(map[string]int, len(counts))
+	for k, v := range counts {
+		result[k] = v
+	}
+	return result
+}
+
+func decodeConfig(t *testing.T, body string) *runner.Config {
+	cfg := &runner.Config{}
+	require.NoError(t, yaml.Unmarshal([]byte(body), cfg))
+	return cfg
+}
+
+func TestSchedulerApply(t *testing.T) {
+	counter := &runCounter{runs: make(map[string]int), failures: make(map[string]int)}
+	ctx, cancel := context.WithCancel(runner.WithObserver(context.Background(), counter))
+	defer cancel()
+	scheduler := runner.NewScheduler(ctx, time.Second)
+
+	const jobs = `
+jobs:
+  - job_name: plain
+    interval: 1h
+    steps:
+      - type: value
+        value: 1
+  - job_name: uses_first
+    interval: 1h
+    steps:
+      - type: first
+  - job_name: uses_second
+    interval: 1h
+    steps:
+      - type: javascript
+        script: run("second", {})
+`
+	scheduler.Apply(decodeConfig(t, `
+transformers:
+  first: {type: value, value: 1}
+  second: {type: value, value: 2}
+`+jobs+`
+  - job_name: removed
+    interval: 1h
+    steps:
+      - type: value
+        value: 1
+`))
+	require.Eventually(t, func() bool {
+		return len(counter.get(counter.runs)) == 4
+	}, time.Second, 10*time.Millisecond)
+
+	scheduler.Apply(decodeConfig(t, `
+transformers:
+  first: {type: value, value: changed}
+  second: {type: value, value: 2}
+`+jobs+`
+  - job_name: added
+    interval: 1h
+    steps:
+      - type: value
+        value: 1
+`))
+	require.Eventually(t, func() bool {
+		return counter.get(counter.runs)["added"] == 1 && counter.get(counter.runs)["uses_first"] == 2
+	}, time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, map[string]int{"plain": 1, "uses_first": 2, "uses_second": 1, "removed": 1, "added": 1}, counter.get(counter.runs))
+}
+
+func TestSchedulerDrainTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	counter := &runCounter{runs: make(map[string]int), failures: make(map[string]int)}
+	ctx, cancel := context.WithCancel(runner.WithObserver(context.Background(), counter))
+	defer cancel()
+	scheduler := runner.NewScheduler(ctx, 100*time.Millisecond)
+
+	config := func(version int) *runner.Config {
+		return decodeConfig(t, fmt.Sprintf(`
+jobs:
+  - job_name: slow
+    interval: 1h
+    steps:
+      - type: http
+        url: %s/%d
+`, server.URL, version))
+	}
+	scheduler.Apply(config(1))
+	require.Eventually(t, func() bool {
+		return counter.get(counter.runs)["slow"] == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// the hanging run is cancelled after the drain timeout and the new version starts after it
+	start := time.Now()
+	scheduler.Apply(config(2))
+	require.Eventually(t, func() bool {
+		return counter.get(counter.runs)["slow"] == 2
+	}, 2*time.Second, 10*time.Millisecond)
+	require.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+	require.Equal(t, 1, counter.get(counter.failures)["slow"])
+}
+
+func TestSchedulerShutdown(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-r.Context().Done()
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	counter := &runCounter{runs: make(map[string]int), failures: make(map[string]int)}
+	scheduler := runner.NewScheduler(runner.WithObserver(context.Background(), counter), time.Second)
+	scheduler.Apply(decodeConfig(t, fmt.Sprintf(`
+jobs:
+  - job_name: quick
+    interval: 1h
+    steps:
+      - type: http
+        url: %[1]s/quick
+  - job_name: slow
+    interval: 1h
+    steps:
+      - type: http
+        url: %[1]s/slow
+  - job_name: idle
+    schedule: '@yearly'
+    steps:
+      - type: value
+        value: 1
+`, server.URL)))
+	require.Eventually(t, func() bool {
+		return len(counter.get(counter.runs)) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	require.Equal(t, []string{"slow"}, scheduler.Shutdown(300*time.Millisecond))
+	require.Equal(t, map[string]int{"slow": 1}, counter.get(counter.failures))
+
+	// configs applied after shutdown do not start anything
+	scheduler.Apply(decodeConfig(t, "jobs:\n  - job_name: late\n    steps:\n      - type: value\n        value: 1\n"))
+	time.Sleep(50 * time.Millisecond)
+	require.NotContains(t, counter.get(counter.runs), "late")
+}
+
+func TestSchedulerChangedTwice(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/1" {
+			<-r.Context().Done()
+		}
+	}))
+	defer server.Close()
+
+	counter := &runCounter{runs: make(map[string]int), failures: make(map[string]int)}
+	ctx, cancel := context.WithCancel(runner.WithObserver(context.Background(), counter))
+	defer cancel()
+	scheduler := runner.NewScheduler(ctx, 200*time.Millisecond)
+	defer scheduler.Shutdown(time.Second)
+
+	config := func(version int) *runner.Config {
+		return decodeConfig(t, fmt.Sprintf(`
+jobs:
+  - job_name: twice
+    interval: 1h
+    steps:
+      - type: http
+        url: %s/%d
+      - type: value
+        value: {v: 1}
+      - type: metric
+        name: test_changed_v%[2]d
+        value: v
+`, server.URL, version))
+	}
+	scheduler.Apply(config(1))
+	require.Eventually(t, func() bool {
+		return counter.get(counter.runs)["twice"] == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// the third version waits for the first one although the second one never ran
+	start := time.Now()
+	scheduler.Apply(config(2))
+	scheduler.Apply(config(3))
+	require.Eventually(t, func() bool {
+		return counter.get(counter.runs)["twice"] == 2
+	}, 2*time.Second, 10*time.Millisecond)
+	require.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+	require.Equal(t, 1, counter.get(counter.failures)["twice"])
+
+	require.Eventually(t, func() bool {
+		return metricNames(t)["test_changed_v3"]
+	}, time.Second, 10*time.Millisecond)
+	metrics.ForgetJob("twice")
+}
+
+func TestSchedulerReadded(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// only the first run hangs
+		if requests.Add(1) == 1 {
+			<-r.Context().Done()
+		}
+	}))
+	defer server.Close()
+
+	counter := &runCounter{runs: make(map[string]int), failures: make(map[string]int)}
+	ctx, cancel := context.WithCancel(runner.WithObserver(context.Background(), counter))
+	defer cancel()
+	scheduler := runner.NewScheduler(ctx, 200*time.Millisecond)
+	defer scheduler.Shutdown(time.Second)
+
+	config := fmt.Sprintf(`
+jobs:
+  - job_name: readded
+    interval: 1h
+    steps:
+      - type: http
+        url: %s
+`, server.URL)
+	scheduler.Apply(decodeConfig(t, config))
+	require.Eventually(t, func() bool {
+		return counter.get(counter.runs)["readded"] == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// the job added again waits for the run of the removed one
+	start := time.Now()
+	scheduler.Apply(decodeConfig(t, "jobs: []\n"))
+	scheduler.Apply(decodeConfig(t, config))
+	require.Eventually(t, func() bool {
+		return counter.get(counter.runs)["readded"] == 2
+	}, 2*time.Second, 10*time.Millisecond)
+	require.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+	require.Equal(t, 1, counter.get(counter.failures)["readded"])
+}
+
+func TestSchedulerChangedSeries(t *testing.T) {
+	counter := &runCounter{runs: make(map[string]int), failures: make(map[string]int)}
+	ctx, cancel := context.WithCancel(runner.WithObserver(context.Background(), counter))
+	defer cancel()
+	scheduler := runner.NewScheduler(ctx, time.Second)
+	defer scheduler.Shutdown(time.Second)
+	defer metrics.ForgetJob("renamed")
+
+	config := func(name string) *runner.Config {
+		return decodeConfig(t, fmt.Sprintf(`
+jobs:
+  - job_name: renamed
+    interval: 1h
+    steps:
+      - type: value
+        value: {v: 1}
+      - type: metric
+        name: %s
+        value: v
+`, name))
+	}
+	scheduler.Apply(config("test_renamed_old"))
+	require.Eventually(t, func() bool {
+		return metricNames(t)["test_renamed_old"]
+	}, time.Second, 10*time.Millisecond)
+
+	// a comment does not change the job
+	scheduler.Apply(decodeConfig(t, `
+jobs:
+  # renamed soon
+  - job_name: renamed
+    interval: 1h # hourly
+    steps:
+      - type: value
+        value: {v: 1}
+      - type: metric
+        name: test_renamed_old
+        value: v
+`))
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, 1, counter.get(counter.runs)["renamed"])
+
+	scheduler.Apply(config("test_renamed_new"))
+	require.Eventually(t, func() bool {
+		return metricNames(t)["test_renamed_new"]
+	}, time.Second, 10*time.Millisecond)
+	require.False(t, metricNames(t)["test_renamed_old"])
+}
+
+// metricNames returns the names of metric families currently gathered
+func metricNames(t *testing.T) map[string]bool {
+	families, err := metrics.Registry.Gather()
+	require.NoError(t, err)
+	names := make(map[string]bool, len(families))
+	for _, family := range families {
+		names[family.GetName()] = true
+	}
+	return names
+}
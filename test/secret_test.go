@@ -0,0 +1,165 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vitrevance/api-exporter/pkg/runner"
+	"github.com/vitrevance/api-exporter/pkg/secret"
+	"github.com/vitrevance/api-exporter/pkg/transformer"
+	"gopkg.in/yaml.v3"
+
+	_ "github.com/vitrevance/api-exporter/pkg/transformer/http"
+	_ "github.com/vitrevance/api-exporter/pkg/transformer/js"
+	_ "github.com/vitrevance/api-exporter/pkg/transformer/print"
+	_ "github.com/vitrevance/api-exporter/pkg/transformer/value"
+)
+
+func TestInterpolation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(path, []byte("file-private-value\n"), 0600))
+	t.Setenv("API_EXPORTER_TEST_TOKEN", "env-private-value")
+	t.Setenv("API_EXPORTER_TEST_TIMEOUT", "2s")
+
+	cfg := &runner.Config{}
+	require.NoError(t, yaml.Unmarshal([]byte(`
+jobs:
+  - job_name: a
+    timeout: ${env:API_EXPORTER_TEST_TIMEOUT}
+    steps:
+      - type: value
+        value:
+          env: ${env:API_EXPORTER_TEST_TOKEN}
+          file: Bearer ${file:`+path+`}
+          default: ${env:API_EXPORTER_TEST_UNSET:-fallback}
+          escaped: $${env:API_EXPORTER_TEST_TOKEN}
+          other: $${HOME} $$x
+      - type: print
+        format: "%v"
+`), cfg))
+	job, ok := cfg.Job("a")
+	require.True(t, ok)
+	require.Equal(t, "2s", job.Timeout.String())
+
+	tctx := &transformer.TransformationContext{Object: map[string]any{}, Result: map[string]any{}}
+	require.NoError(t, job.Steps[0].Transformer.Transform(tctx))
+	require.Equal(t, map[string]any{
+		"env":     "env-private-value",
+		"file":    "Bearer file-private-value",
+		"default": "fallback",
+		"escaped": "${env:API_EXPORTER_TEST_TOKEN}",
+		"other":   "$${HOME} $$x",
+	}, tctx.Result)
+
+	// resolved values are secrets of the config once it is in use
+	secret.SetRules(cfg.Redact, cfg.Secrets)
+	object := tctx.Result
+	tctx = &transformer.TransformationContext{Object: object, Result: map[string]any{}}
+	require.NoError(t, job.Steps[1].Transformer.Transform(tctx))
+	require.NotContains(t, tctx.Result, "private-value")
+	require.Contains(t, tctx.Result, "Bearer "+secret.Placeholder)
+
+	// and no longer once another config is
+	secret.SetRules(nil, nil)
+	tctx = &transformer.TransformationContext{Object: object, Result: map[string]any{}}
+	require.NoError(t, job.Steps[1].Transformer.Transform(tctx))
+	require.Contains(t, tctx.Result, "Bearer file-private-value")
+
+	err := yaml.Unmarshal([]byte(`
+jobs:
+  - job_name: a
+    steps:
+      - type: value
+        value: ${env:API_EXPORTER_TEST_UNSET}
+`), &runner.Config{})
+	require.EqualError(t, err, "line 6, column 16: environment variable API_EXPORTER_TEST_UNSET is not set")
+
+	// errors of a config that is not in use hide its secrets
+	t.Setenv("API_EXPORTER_TEST_TIMEOUT", "12parsecs")
+	err = yaml.Unmarshal([]byte(`
+jobs:
+  - job_name: a
+    timeout: ${env:API_EXPORTER_TEST_TIMEOUT}
+    steps: []
+`), &runner.Config{})
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "12parsecs")
+	require.Contains(t, err.Error(), secret.Placeholder)
+}
+
+func TestRedaction(t *testing.T) {
+	// the server echoes credentials into the error body
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, password, _ := r.BasicAuth()
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "access denied, key %s password %s user_id=12345", r.Header.Get("X-Api-Key"), password)
+	}))
+	defer server.Close()
+
+	cfg := &runner.Config{}
+	require.NoError(t, yaml.Unmarshal([]byte(fmt.Sprintf(`
+redact:
+  - 'user_id=\d+'
+  - pattern: '(access) denied'
+    replacement: '$1 refused'
+transformers:
+  fetch:
+    type: http
+    url: %s
+    headers:
+      X-Api-Key: key-from-header
+    basic_auth_username: user
+    basic_auth_password: password-from-config
+    expect_status: [2xx]
+jobs:
+  - job_name: direct
+    steps:
+      - type: fetch
+  - job_name: script
+    steps:
+      - type: javascript
+        script: run("fetch", {}).error
+`, server.URL)), cfg))
+	secret.SetRules(cfg.Redact, cfg.Secrets)
+	defer secret.SetRules(nil, nil)
+
+	job, _ := cfg.Job("direct")
+	err := cfg.RunJob(context.Background(), job, map[string]any{})
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "key-from-header")
+	require.NotContains(t, err.Error(), "password-from-config")
+	require.NotContains(t, err.Error(), "12345")
+	require.Contains(t, err.Error(), "access refused")
+
+	job, _ = cfg.Job("script")
+	observer := &recordingObserver{}
+	require.NoError(t, cfg.RunJob(runner.WithObserver(context.Background(), observer), job, map[string]any{}))
+	require.NotContains(t, observer.steps[1], "key-from-header")
+	require.NotContains(t, observer.steps[1], "password-from-config")
+
+	var out bytes.Buffer
+	fmt.Fprint(secret.Writer(&out), "logged key-from-header")
+	require.Equal(t, "logged "+secret.Placeholder, out.String())
+}
+
+func TestRegisterBounded(t *testing.T) {
+	secret.Register("bounded-kept")
+	secret.Register("bounded-first")
+	for i := 0; i < secret.MaxValues-1; i++ {
+		// a value registered again is used recently
+		if i == secret.MaxValues/2 {
+			secret.Register("bounded-kept")
+		}
+		secret.Register(fmt.Sprintf("bounded-token-%d", i))
+	}
+	require.Equal(t, "bounded-first", secret.Redact("bounded-first"))
+	require.Equal(t, secret.Placeholder, secret.Redact("bounded-kept"))
+	require.Equal(t, secret.Placeholder, secret.Redact(fmt.Sprintf("bounded-token-%d", secret.MaxValues-2)))
+}
@@ -1,7 +1,9 @@
 package test
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"github.com/vitrevance/api-exporter/pkg/transformer"
@@ -9,6 +11,8 @@ import (
 
 	_ "github.com/vitrevance/api-exporter/pkg/transformer/array"
 	_ "github.com/vitrevance/api-exporter/pkg/transformer/field"
+	_ "github.com/vitrevance/api-exporter/pkg/transformer/js"
+	_ "github.com/vitrevance/api-exporter/pkg/transformer/sequence"
 )
 
 const config = `
@@ -91,3 +95,39 @@ func TestArray(t *testing.T) {
 		}, ctx.Result.(map[string]any)["items"])
 	}
 }
+
+func TestTimeout(t *testing.T) {
+	ts := make(map[string]transformer.TransformerConfig)
+	require.NoError(t, yaml.Unmarshal([]byte(`
+loop:
+  type: javascript
+  timeout: 50ms
+  script: while (true) {}
+seq:
+  type: sequence
+  steps:
+    - type: javascript
+      script: return 1
+    - type: javascript
+      script: return 2
+`), &ts))
+	require.Equal(t, 50*time.Millisecond, ts["loop"].Timeout)
+
+	{
+		ctx := &transformer.TransformationContext{
+			Object: make(map[string]any),
+			Result: make(map[string]any),
+		}
+		require.ErrorIs(t, ts["loop"].Transformer.Transform(ctx), context.DeadlineExceeded)
+	}
+	{
+		cancelled, cancel := context.WithCancel(context.Background())
+		cancel()
+		ctx := &transformer.TransformationContext{
+			Context: cancelled,
+			Object:  make(map[string]any),
+			Result:  make(map[string]any),
+		}
+		require.ErrorIs(t, ts["seq"].Transformer.Transform(ctx), context.Canceled)
+	}
+}
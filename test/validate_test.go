@@ -0,0 +1,105 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vitrevance/api-exporter/pkg/runner"
+	"github.com/vitrevance/api-exporter/pkg/transformer"
+	"gopkg.in/yaml.v3"
+
+	_ "github.com/vitrevance/api-exporter/pkg/transformer/regex"
+)
+
+func TestValidate(t *testing.T) {
+	errs := runner.Validate([]byte(`
+transformers:
+  fetch:
+    type: http
+    querry_params:
+      a: b
+jobs:
+  - job_name: a
+    interval: 5x
+    steps:
+      - type: regex
+        match: '('
+      - type: javascript
+        script: return run("fetch", {}) && run("missing", {})
+      - type: fetchh
+      - type: fetch
+        keep_ctx: true
+        ctx: {}
+  - job_name: a
+    steps:
+      - type: sequence
+        steps:
+          - type: field
+            keep_context: true
+`))
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	require.Equal(t, []string{
+		`5:5: transformer fetch: unknown field "querry_params"`,
+		"9: job a: cannot unmarshal !!str `5x` into time.Duration",
+		"11:9: job a step [0]: error parsing regexp: missing closing ): `(`",
+		`14:17: script runs undefined transformer "missing"`,
+		`15: job a step [2]: unknown transformer type fetchh`,
+		`19:15: duplicate job_name "a", first defined at line 8`,
+		`24:13: job a step [0]: unknown field "keep_context"`,
+	}, messages)
+
+	require.Empty(t, runner.Validate([]byte(`
+transformers:
+  fetch:
+    type: http
+jobs:
+  - job_name: a
+    interval: 5s
+    steps:
+      - type: fetch
+        timeout: 1s
+`)))
+
+	// transformer factories registered during validation are released
+	require.Empty(t, runner.Validate([]byte(`
+transformers:
+  fetch:
+    type: http
+`)))
+}
+
+func TestStrictLoading(t *testing.T) {
+	const body = `
+jobs:
+  - job_name: a
+    steps:
+      - type: regex
+        match: 'a'
+        keep_context: true
+`
+	cfg := &runner.Config{}
+	err := yaml.Unmarshal([]byte(body), cfg)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `line 7, column 9: unknown field "keep_context"`)
+
+	cfg = &runner.Config{}
+	require.NoError(t, yaml.Unmarshal([]byte("strict: false"+body), cfg))
+	require.Len(t, cfg.Jobs, 1)
+	require.True(t, transformer.StrictDecoding())
+
+	// validation agrees with loading
+	require.Len(t, runner.Validate([]byte(body)), 1)
+	require.Empty(t, runner.Validate([]byte("strict: false"+body)))
+	require.True(t, transformer.StrictDecoding())
+
+	// redaction rules are strict too
+	err = yaml.Unmarshal([]byte(`
+redact:
+  - pattern: 'key=\w+'
+    replacment: key=***
+`), &runner.Config{})
+	require.ErrorContains(t, err, `unknown field "replacment"`)
+}